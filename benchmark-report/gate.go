@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// stageTiming is the timing of one benchmark stage used by the regression gate
+type stageTiming struct {
+	Name    string
+	Seconds float64
+}
+
+// StageDelta compares one stage of the current run against the baseline
+type StageDelta struct {
+	Name      string
+	Baseline  float64
+	Current   float64
+	Percent   float64
+	Regressed bool
+	// Missing is set when the stage is in the baseline but not in the
+	// current run, for example because every file of the run failed
+	Missing bool
+}
+
+// simHashStageNames are the per-file stages of a calculate-simhash report
+var simHashStageNames = []string{
+	"file_read_time",
+	"feature_extraction_time",
+	"simhash_calculation_time",
+	"simhash_encoding_time",
+	"total_processing_time",
+}
+
+// loadStageTimings reads a calculate-simhash or fetch-captures JSON report and
+// returns its stage timings. The report kind is detected from its fields
+func loadStageTimings(path string) ([]stageTiming, error) {
+	var raw struct {
+		Summary         json.RawMessage `json:"summary"`
+		DetailedTimings json.RawMessage `json:"detailed_capture_timings"`
+	}
+	if err := readJSON(path, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw.DetailedTimings != nil {
+		var b FetchBenchmark
+		if err := readJSON(path, &b); err != nil {
+			return nil, err
+		}
+		return fetchStageTimings(&b), nil
+	}
+	if raw.Summary != nil {
+		return simHashStageTimings(path)
+	}
+	return nil, fmt.Errorf("%s is not a calculate-simhash or fetch-captures report", path)
+}
+
+// fetchStageTimings returns the CDX fetch time, the mean download time per
+// capture and the total time of a fetch-captures run
+func fetchStageTimings(b *FetchBenchmark) []stageTiming {
+	meanDownload := 0.0
+	if len(b.DetailedTimings) > 0 {
+		for _, t := range b.DetailedTimings {
+			meanDownload += t.DownloadTime
+		}
+		meanDownload /= float64(len(b.DetailedTimings))
+	}
+
+	return []stageTiming{
+		{Name: "cdx_fetch_time", Seconds: b.Summary.CDXFetchTime},
+		{Name: "capture_download_time", Seconds: meanDownload},
+		{Name: "total_time", Seconds: b.Summary.TotalTime},
+	}
+}
+
+// simHashStageTimings returns the mean time of each per-file stage and the
+// total benchmark time of a calculate-simhash run. Stage statistics from
+// repeated iterations are preferred over the per-file results
+func simHashStageTimings(path string) ([]stageTiming, error) {
+	var report struct {
+		Summary struct {
+			TotalBenchmarkTime float64 `json:"total_benchmark_time"`
+			Stages             map[string]struct {
+				Mean float64 `json:"mean"`
+			} `json:"stages"`
+		} `json:"summary"`
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := readJSON(path, &report); err != nil {
+		return nil, err
+	}
+
+	var timings []stageTiming
+	for _, name := range simHashStageNames {
+		if stage, ok := report.Summary.Stages[name]; ok {
+			timings = append(timings, stageTiming{Name: name, Seconds: stage.Mean})
+			continue
+		}
+
+		sum, count := 0.0, 0
+		for _, result := range report.Results {
+			if msg, _ := result["error"].(string); msg != "" {
+				continue
+			}
+			if v, ok := result[name].(float64); ok {
+				sum += v
+				count++
+			}
+		}
+		if count > 0 {
+			timings = append(timings, stageTiming{Name: name, Seconds: sum / float64(count)})
+		}
+	}
+
+	total := report.Summary.TotalBenchmarkTime
+	if stage, ok := report.Summary.Stages["total_benchmark_time"]; ok {
+		total = stage.Mean
+	}
+	timings = append(timings, stageTiming{Name: "total_benchmark_time", Seconds: total})
+
+	return timings, nil
+}
+
+// compareStages computes the per-stage deltas of current against baseline. A
+// stage regresses when it is more than maxRegression percent slower and the
+// absolute slowdown exceeds minDelta seconds. Against a zero baseline it
+// regresses when it takes longer than minDelta. Baseline stages missing from
+// the current run are returned with Missing set
+func compareStages(baseline, current []stageTiming, maxRegression, minDelta float64) []StageDelta {
+	currentByName := make(map[string]float64, len(current))
+	for _, t := range current {
+		currentByName[t.Name] = t.Seconds
+	}
+
+	var deltas []StageDelta
+	for _, b := range baseline {
+		c, ok := currentByName[b.Name]
+		if !ok {
+			deltas = append(deltas, StageDelta{Name: b.Name, Baseline: b.Seconds, Missing: true})
+			continue
+		}
+		d := StageDelta{Name: b.Name, Baseline: b.Seconds, Current: c}
+		if b.Seconds > 0 {
+			d.Percent = (c - b.Seconds) / b.Seconds * 100
+			d.Regressed = d.Percent > maxRegression && c-b.Seconds > minDelta
+		} else {
+			// No percentage exists against a zero baseline; any slowdown
+			// beyond the noise floor counts as a regression
+			d.Regressed = c > minDelta
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// writeDeltaTable writes the per-stage comparison as a Markdown table
+func writeDeltaTable(w io.Writer, deltas []StageDelta, maxRegression float64) {
+	fmt.Fprintf(w, "| Stage | Baseline (s) | Current (s) | Delta | Status |\n")
+	fmt.Fprintf(w, "|-------|--------------|-------------|-------|--------|\n")
+	for _, d := range deltas {
+		status := "ok"
+		delta := "-"
+		current := fmt.Sprintf("%.6f", d.Current)
+		switch {
+		case d.Missing:
+			status = "MISSING from current run"
+			current = "-"
+		case d.Baseline <= 0 && d.Regressed:
+			status = "REGRESSION (zero baseline)"
+		case d.Baseline <= 0:
+			status = "ok (zero baseline)"
+		case d.Regressed:
+			status = fmt.Sprintf("REGRESSION (> %.1f%%)", maxRegression)
+		}
+		if d.Baseline > 0 && !d.Missing {
+			delta = fmt.Sprintf("%+.1f%%", d.Percent)
+		}
+		fmt.Fprintf(w, "| %s | %.6f | %s | %s | %s |\n", d.Name, d.Baseline, current, delta, status)
+	}
+}
+
+// runRegressionGate compares current against baseline, prints the delta table
+// and returns the process exit code: 1 on regression, 2 on error
+func runRegressionGate(w io.Writer, baselinePath, currentPath string, maxRegression, minDelta float64) int {
+	baseline, err := loadStageTimings(baselinePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load baseline: %v\n", err)
+		return 2
+	}
+	current, err := loadStageTimings(currentPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load current results: %v\n", err)
+		return 2
+	}
+
+	deltas := compareStages(baseline, current, maxRegression, minDelta)
+	writeDeltaTable(w, deltas, maxRegression)
+
+	regressions, missing := 0, 0
+	for _, d := range deltas {
+		switch {
+		case d.Missing:
+			missing++
+		case d.Regressed:
+			regressions++
+		}
+	}
+	if missing > 0 {
+		fmt.Fprintf(w, "\n%d baseline stage(s) missing from the current run\n", missing)
+	}
+	if regressions > 0 {
+		fmt.Fprintf(w, "\n%d stage(s) regressed by more than %.1f%%\n", regressions, maxRegression)
+	}
+	if missing > 0 || regressions > 0 {
+		return 1
+	}
+	fmt.Fprintf(w, "\nNo stage regressed by more than %.1f%%\n", maxRegression)
+	return 0
+}
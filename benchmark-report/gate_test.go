@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareStages(t *testing.T) {
+	baseline := []stageTiming{
+		{Name: "regressed", Seconds: 1.0},
+		{Name: "noise", Seconds: 0.00001},
+		{Name: "faster", Seconds: 2.0},
+		{Name: "zero", Seconds: 0},
+		{Name: "zero_ok", Seconds: 0},
+		{Name: "missing", Seconds: 0.5},
+	}
+	current := []stageTiming{
+		{Name: "regressed", Seconds: 1.5},
+		// 100% slower but only by 10µs, under minDelta
+		{Name: "noise", Seconds: 0.00002},
+		{Name: "faster", Seconds: 1.0},
+		{Name: "zero", Seconds: 0.01},
+		{Name: "zero_ok", Seconds: 0.00005},
+		{Name: "extra", Seconds: 1.0},
+	}
+
+	deltas := compareStages(baseline, current, 10, 0.0001)
+	want := []StageDelta{
+		{Name: "regressed", Baseline: 1.0, Current: 1.5, Percent: 50, Regressed: true},
+		{Name: "noise", Baseline: 0.00001, Current: 0.00002, Percent: 100},
+		{Name: "faster", Baseline: 2.0, Current: 1.0, Percent: -50},
+		{Name: "zero", Baseline: 0, Current: 0.01, Regressed: true},
+		{Name: "zero_ok", Baseline: 0, Current: 0.00005},
+		{Name: "missing", Baseline: 0.5, Missing: true},
+	}
+	if !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas =\n%+v\nwant\n%+v", deltas, want)
+	}
+}
+
+// writeReport writes a calculate-simhash JSON report with the given stage means
+func writeReport(t *testing.T, dir, name, stages string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	report := `{"summary": {"total_benchmark_time": 1.0, "stages": {` + stages + `}}, "results": []}`
+	if err := os.WriteFile(path, []byte(report), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunRegressionGate(t *testing.T) {
+	dir := t.TempDir()
+	baseline := writeReport(t, dir, "baseline.json",
+		`"feature_extraction_time": {"mean": 0.01}, "simhash_encoding_time": {"mean": 0}`)
+
+	tests := []struct {
+		name   string
+		stages string
+		want   int
+	}{
+		{
+			name:   "unchanged",
+			stages: `"feature_extraction_time": {"mean": 0.01}, "simhash_encoding_time": {"mean": 0}`,
+			want:   0,
+		},
+		{
+			name:   "regression over the threshold",
+			stages: `"feature_extraction_time": {"mean": 0.02}, "simhash_encoding_time": {"mean": 0}`,
+			want:   1,
+		},
+		{
+			name:   "slowdown under min-delta",
+			stages: `"feature_extraction_time": {"mean": 0.01005}, "simhash_encoding_time": {"mean": 0}`,
+			want:   0,
+		},
+		{
+			name:   "zero baseline",
+			stages: `"feature_extraction_time": {"mean": 0.01}, "simhash_encoding_time": {"mean": 0.001}`,
+			want:   1,
+		},
+		{
+			name:   "missing stage",
+			stages: `"simhash_encoding_time": {"mean": 0}`,
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := writeReport(t, dir, "current.json", tt.stages)
+			if got := runRegressionGate(io.Discard, baseline, current, 10, 0.0001); got != tt.want {
+				t.Errorf("exit code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := runRegressionGate(io.Discard, baseline, filepath.Join(dir, "absent.json"), 10, 0.0001); got != 2 {
+		t.Errorf("exit code for a missing report = %d, want 2", got)
+	}
+}
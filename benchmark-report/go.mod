@@ -0,0 +1,3 @@
+module github.com/rudransh-shrivastava/wayback-discover-diff-benchmarks-go-python/benchmark-report
+
+go 1.24.1
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// yearField accepts a year encoded either as a JSON string (Go output) or a
+// JSON number (Python output)
+type yearField string
+
+func (y *yearField) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*y = yearField(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("year must be a string or number: %v", err)
+	}
+	*y = yearField(n.String())
+	return nil
+}
+
+// errorField accepts the error value of a capture timing, which is a string
+// in Go output and a boolean in Python output
+type errorField bool
+
+func (e *errorField) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "null", "false", `""`:
+		*e = false
+	default:
+		*e = true
+	}
+	return nil
+}
+
+// FetchBenchmark is the subset of a fetch-captures benchmark file shared by
+// the Go and Python implementations
+type FetchBenchmark struct {
+	URL     string    `json:"url"`
+	Year    yearField `json:"year"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Summary struct {
+		Captures struct {
+			Total                  int     `json:"total"`
+			Processed              int     `json:"processed"`
+			DownloadTime           float64 `json:"download_time"`
+			FeatureExtractionTime  float64 `json:"feature_extraction_time"`
+			SimHashCalculationTime float64 `json:"simhash_calculation_time"`
+		} `json:"captures"`
+		CDXFetchTime float64 `json:"cdx_fetch_time"`
+		// CDXCacheHits is set by Go runs when CDX responses came from the
+		// local cache, so their CDX fetch time does not measure the archive
+		CDXCacheHits int     `json:"cdx_cache_hits"`
+		TotalTime    float64 `json:"total_time"`
+	} `json:"summary"`
+	DetailedTimings []CaptureTiming `json:"detailed_capture_timings"`
+}
+
+// period labels the capture range of a run: the year for single-year runs,
+// otherwise from-to as in the fetch-captures output file names
+func (b *FetchBenchmark) period() string {
+	if b.Year != "" {
+		return string(b.Year)
+	}
+	if b.From == b.To {
+		return b.From
+	}
+	return b.From + "-" + b.To
+}
+
+// CaptureTiming is one entry of detailed_capture_timings. The Python output
+// records a download entry and a processing entry per capture, and a single
+// cached entry for captures whose digest was already processed
+type CaptureTiming struct {
+	Timestamp    string  `json:"timestamp"`
+	DownloadTime float64 `json:"download_time"`
+	// Size is nil when the entry records no download
+	Size   *int       `json:"size"`
+	Cached bool       `json:"cached"`
+	Error  errorField `json:"error"`
+}
+
+// SimHashBenchmark is the summary section of a calculate-simhash JSON report
+type SimHashBenchmark struct {
+	Summary struct {
+		TotalBenchmarkTime        float64 `json:"total_benchmark_time"`
+		FilesProcessed            int     `json:"files_processed"`
+		AverageFileProcessingTime float64 `json:"average_file_processing_time"`
+	} `json:"summary"`
+}
+
+// benchmarkKey joins Go and Python runs of the same URL and capture period
+type benchmarkKey struct {
+	URL    string
+	Period string
+}
+
+// benchmarkPair holds the Go and Python runs for one key; either may be nil
+type benchmarkPair struct {
+	Key    benchmarkKey
+	Go     *FetchBenchmark
+	Python *FetchBenchmark
+}
+
+// captureOutcome is the merged result of all timing entries for a timestamp
+type captureOutcome struct {
+	Failed bool
+	Size   int
+	// HasSize is set when an entry recorded a download size
+	HasSize bool
+	// Cached is set when the capture was skipped as a known digest
+	Cached bool
+}
+
+// Discrepancy describes a capture that was handled differently by the two
+// implementations
+type Discrepancy struct {
+	Key       benchmarkKey
+	Timestamp string
+	Reason    string
+}
+
+// loadFetchBenchmarks reads every JSON benchmark file in dir, keyed by URL and period
+func loadFetchBenchmarks(dir string) (map[benchmarkKey]*FetchBenchmark, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	benchmarks := make(map[benchmarkKey]*FetchBenchmark)
+	for _, file := range files {
+		var b FetchBenchmark
+		if err := readJSON(file, &b); err != nil {
+			return nil, err
+		}
+		benchmarks[benchmarkKey{URL: b.URL, Period: b.period()}] = &b
+	}
+	return benchmarks, nil
+}
+
+// readJSON decodes the JSON file at path into v
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// joinBenchmarks pairs Go and Python runs by URL and period, sorted by key
+func joinBenchmarks(goRuns, pythonRuns map[benchmarkKey]*FetchBenchmark) []benchmarkPair {
+	keys := make(map[benchmarkKey]bool)
+	for k := range goRuns {
+		keys[k] = true
+	}
+	for k := range pythonRuns {
+		keys[k] = true
+	}
+
+	pairs := make([]benchmarkPair, 0, len(keys))
+	for k := range keys {
+		pairs = append(pairs, benchmarkPair{Key: k, Go: goRuns[k], Python: pythonRuns[k]})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Key.URL != pairs[j].Key.URL {
+			return pairs[i].Key.URL < pairs[j].Key.URL
+		}
+		return pairs[i].Key.Period < pairs[j].Key.Period
+	})
+	return pairs
+}
+
+// captureOutcomes merges timing entries by timestamp. A capture failed if any
+// of its entries reports an error
+func captureOutcomes(b *FetchBenchmark) map[string]captureOutcome {
+	outcomes := make(map[string]captureOutcome)
+	for _, t := range b.DetailedTimings {
+		o := outcomes[t.Timestamp]
+		o.Failed = o.Failed || bool(t.Error)
+		o.Cached = o.Cached || t.Cached
+		if t.Size != nil {
+			o.Size = *t.Size
+			o.HasSize = true
+		}
+		outcomes[t.Timestamp] = o
+	}
+	return outcomes
+}
+
+// findDiscrepancies lists captures missing from one run, fetched by only one
+// implementation, or fetched with different sizes. Sizes are only compared
+// when both runs downloaded the capture
+func findDiscrepancies(pair benchmarkPair) []Discrepancy {
+	if pair.Go == nil || pair.Python == nil {
+		return nil
+	}
+
+	goOutcomes := captureOutcomes(pair.Go)
+	pyOutcomes := captureOutcomes(pair.Python)
+
+	timestamps := make(map[string]bool)
+	for ts := range goOutcomes {
+		timestamps[ts] = true
+	}
+	for ts := range pyOutcomes {
+		timestamps[ts] = true
+	}
+	sorted := make([]string, 0, len(timestamps))
+	for ts := range timestamps {
+		sorted = append(sorted, ts)
+	}
+	sort.Strings(sorted)
+
+	var discrepancies []Discrepancy
+	for _, ts := range sorted {
+		g, inGo := goOutcomes[ts]
+		p, inPython := pyOutcomes[ts]
+
+		var reason string
+		switch {
+		case !inGo:
+			reason = "missing from Go results"
+		case !inPython:
+			reason = "missing from Python results"
+		case g.Failed && !p.Failed:
+			reason = "failed in Go only"
+		case !g.Failed && p.Failed:
+			reason = "failed in Python only"
+		case !g.Failed && !p.HasSize && p.Cached:
+			reason = "not downloaded by Python (cached digest)"
+		case !g.Failed && !p.HasSize:
+			reason = "not downloaded by Python"
+		case !g.Failed && !g.HasSize:
+			reason = "not downloaded by Go"
+		case !g.Failed && g.Size != p.Size:
+			reason = fmt.Sprintf("size differs (Go %d bytes, Python %d bytes)", g.Size, p.Size)
+		default:
+			continue
+		}
+		discrepancies = append(discrepancies, Discrepancy{Key: pair.Key, Timestamp: ts, Reason: reason})
+	}
+	return discrepancies
+}
+
+// speedup returns how many times faster Go was than Python, formatted for a table
+func speedup(goTime, pythonTime float64) string {
+	if goTime <= 0 || pythonTime <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fx", pythonTime/goTime)
+}
+
+// writeFetchTables writes the per-run comparison and speedup tables
+func writeFetchTables(w io.Writer, pairs []benchmarkPair) {
+	fmt.Fprintln(w, "# Fetch Captures Benchmark Results")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Language | URL | Period | Total Captures | Processed Captures | Download Time (s) | Feature Extraction Time (s) | SimHash Calculation Time (s) | CDX Fetch Time (s) | Total Time (s) |")
+	fmt.Fprintln(w, "|----------|-----|------|----------------|--------------------|-------------------|-----------------------------|------------------------------|--------------------|----------------|")
+
+	row := func(language string, key benchmarkKey, b *FetchBenchmark) {
+		c := b.Summary.Captures
+		extraction, calculation := "-", "-"
+		if language == "Python" {
+			extraction = fmt.Sprintf("%.4f", c.FeatureExtractionTime)
+			calculation = fmt.Sprintf("%.4f", c.SimHashCalculationTime)
+		}
+		cdxFetch := fmt.Sprintf("%.2f", b.Summary.CDXFetchTime)
+		if b.Summary.CDXCacheHits > 0 {
+			cdxFetch += " (cached)"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %d | %d | %.2f | %s | %s | %s | %.2f |\n",
+			language, key.URL, key.Period, c.Total, c.Processed, c.DownloadTime,
+			extraction, calculation, cdxFetch, b.Summary.TotalTime)
+	}
+
+	for _, pair := range pairs {
+		if pair.Go != nil {
+			row("Golang", pair.Key, pair.Go)
+		}
+		if pair.Python != nil {
+			row("Python", pair.Key, pair.Python)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Speedup (Python time / Go time)")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| URL | Period | CDX Fetch | Download | Total |")
+	fmt.Fprintln(w, "|-----|------|-----------|----------|-------|")
+	for _, pair := range pairs {
+		if pair.Go == nil || pair.Python == nil {
+			continue
+		}
+		g, p := pair.Go.Summary, pair.Python.Summary
+		cdxSpeedup := speedup(g.CDXFetchTime, p.CDXFetchTime)
+		if g.CDXCacheHits > 0 || p.CDXCacheHits > 0 {
+			// A disk read is not comparable with a fetch from the archive
+			cdxSpeedup = "- (cached)"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", pair.Key.URL, pair.Key.Period,
+			cdxSpeedup,
+			speedup(g.Captures.DownloadTime, p.Captures.DownloadTime),
+			speedup(g.TotalTime, p.TotalTime))
+	}
+}
+
+// writeDiscrepancies writes the per-capture discrepancy list
+func writeDiscrepancies(w io.Writer, pairs []benchmarkPair) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Capture Discrepancies")
+	fmt.Fprintln(w)
+
+	found := false
+	for _, pair := range pairs {
+		if pair.Go == nil || pair.Python == nil {
+			side := "Python"
+			if pair.Go == nil {
+				side = "Go"
+			}
+			fmt.Fprintf(w, "- %s (%s): no %s results\n", pair.Key.URL, pair.Key.Period, side)
+			found = true
+			continue
+		}
+		for _, d := range findDiscrepancies(pair) {
+			fmt.Fprintf(w, "- %s (%s) %s: %s\n", d.Key.URL, d.Key.Period, d.Timestamp, d.Reason)
+			found = true
+		}
+	}
+	if !found {
+		fmt.Fprintln(w, "None.")
+	}
+}
+
+// writeSimHashTable writes the calculate-simhash comparison table. Missing
+// reports are skipped
+func writeSimHashTable(w io.Writer, goPath, pythonPath string) error {
+	runs := []struct {
+		name string
+		path string
+		run  *SimHashBenchmark
+	}{
+		{name: "Golang", path: goPath},
+		{name: "Python", path: pythonPath},
+	}
+
+	loaded := false
+	for i := range runs {
+		if runs[i].path == "" {
+			continue
+		}
+		if _, err := os.Stat(runs[i].path); os.IsNotExist(err) {
+			continue
+		}
+		var b SimHashBenchmark
+		if err := readJSON(runs[i].path, &b); err != nil {
+			return err
+		}
+		runs[i].run = &b
+		loaded = true
+	}
+	if !loaded {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# SimHash Benchmark Results")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Benchmark Run | Total Files Processed | Total Benchmark Time (s) | Average File Processing Time (s) |")
+	fmt.Fprintln(w, "|--------------|----------------------|-------------------------|--------------------------------|")
+	for _, r := range runs {
+		if r.run == nil {
+			continue
+		}
+		s := r.run.Summary
+		fmt.Fprintf(w, "| %s | %d | %.4f | %.4f |\n", r.name, s.FilesProcessed, s.TotalBenchmarkTime, s.AverageFileProcessingTime)
+	}
+
+	if runs[0].run != nil && runs[1].run != nil {
+		g, p := runs[0].run.Summary, runs[1].run.Summary
+		fmt.Fprintf(w, "\nGolang was `%s` faster than Python in total benchmark time and `%s` faster in average file processing time.\n",
+			speedup(g.TotalBenchmarkTime, p.TotalBenchmarkTime),
+			speedup(g.AverageFileProcessingTime, p.AverageFileProcessingTime))
+	}
+	return nil
+}
+
+func main() {
+	goDir := flag.String("go-dir", "../fetch-captures/benchmarks-go", "Directory containing Go fetch-captures JSON results")
+	pythonDir := flag.String("python-dir", "../fetch-captures/benchmarks-python", "Directory containing Python fetch-captures JSON results")
+	simHashGo := flag.String("simhash-go", "../calculate-simhash/benchmarks-go/simhash_results.json", "Go calculate-simhash JSON report (skipped if missing)")
+	simHashPython := flag.String("simhash-python", "", "Python calculate-simhash JSON report (skipped if missing)")
+	outPath := flag.String("out", "", "Write the Markdown report to this file instead of stdout")
+	baselinePath := flag.String("baseline", "", "Baseline JSON results; with -current, run the regression gate instead of the report")
+	currentPath := flag.String("current", "", "Current JSON results compared against -baseline")
+	maxRegression := flag.Float64("max-regression", 10, "Maximum allowed slowdown per stage in percent")
+	minDelta := flag.Float64("min-delta", 0.0001, "Ignore slowdowns smaller than this many seconds")
+
+	flag.Parse()
+
+	if *baselinePath != "" || *currentPath != "" {
+		if *baselinePath == "" || *currentPath == "" {
+			log.Fatal("-baseline and -current must be used together")
+		}
+		os.Exit(runRegressionGate(os.Stdout, *baselinePath, *currentPath, *maxRegression, *minDelta))
+	}
+
+	goRuns, err := loadFetchBenchmarks(*goDir)
+	if err != nil {
+		log.Fatalf("Failed to load Go results: %v", err)
+	}
+	pythonRuns, err := loadFetchBenchmarks(*pythonDir)
+	if err != nil {
+		log.Fatalf("Failed to load Python results: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("Failed to create report file: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	pairs := joinBenchmarks(goRuns, pythonRuns)
+	writeFetchTables(out, pairs)
+	writeDiscrepancies(out, pairs)
+
+	if err := writeSimHashTable(out, *simHashGo, *simHashPython); err != nil {
+		log.Fatalf("Failed to build SimHash table: %v", err)
+	}
+
+	if *outPath != "" {
+		log.Printf("Report saved to: %s", *outPath)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// fetchBenchmark decodes detailed capture timings as written by either
+// implementation
+func fetchBenchmark(t *testing.T, timings string) *FetchBenchmark {
+	t.Helper()
+	var b FetchBenchmark
+	if err := json.Unmarshal([]byte(`{"detailed_capture_timings": `+timings+`}`), &b); err != nil {
+		t.Fatal(err)
+	}
+	return &b
+}
+
+func TestFindDiscrepancies(t *testing.T) {
+	goTiming := `{"timestamp": "20230101000000", "download_time": 0.1, "size": 100}`
+
+	tests := []struct {
+		name   string
+		goRun  string
+		python string
+		// want is the reason reported for the capture, empty for none
+		want string
+	}{
+		{
+			name:  "paired download and processing entries",
+			goRun: `[` + goTiming + `]`,
+			python: `[{"timestamp": "20230101000000", "download_time": 0.2, "size": 100, "content_type": "text/html"},
+				{"timestamp": "20230101000000", "cached": false, "download_time": 0.2, "feature_extraction_time": 0.01}]`,
+		},
+		{
+			name:  "paired entries with a different size",
+			goRun: `[` + goTiming + `]`,
+			python: `[{"timestamp": "20230101000000", "download_time": 0.2, "size": 120},
+				{"timestamp": "20230101000000", "cached": false, "download_time": 0.2}]`,
+			want: "size differs (Go 100 bytes, Python 120 bytes)",
+		},
+		{
+			name:   "cached Python entry",
+			goRun:  `[` + goTiming + `]`,
+			python: `[{"timestamp": "20230101000000", "digest": "ABC", "cached": true, "total_time": 0.001}]`,
+			want:   "not downloaded by Python (cached digest)",
+		},
+		{
+			name:   "cached Python entry for a capture that failed in Go",
+			goRun:  `[{"timestamp": "20230101000000", "download_time": 0.1, "error": "connection refused"}]`,
+			python: `[{"timestamp": "20230101000000", "digest": "ABC", "cached": true, "total_time": 0.001}]`,
+			want:   "failed in Go only",
+		},
+		{
+			name:   "Python entry without a download",
+			goRun:  `[` + goTiming + `]`,
+			python: `[{"timestamp": "20230101000000", "cached": false, "total_time": 0.001}]`,
+			want:   "not downloaded by Python",
+		},
+		{
+			name:  "empty Go download",
+			goRun: `[{"timestamp": "20230101000000", "download_time": 0.1, "size": 0}]`,
+			python: `[{"timestamp": "20230101000000", "download_time": 0.2, "size": 0},
+				{"timestamp": "20230101000000", "cached": false, "download_time": 0.2}]`,
+		},
+		{
+			name:  "failed in Python only",
+			goRun: `[` + goTiming + `]`,
+			python: `[{"timestamp": "20230101000000", "download_time": 0.2, "error": true},
+				{"timestamp": "20230101000000", "cached": false, "download_time": 0.2}]`,
+			want: "failed in Python only",
+		},
+		{
+			name:   "missing from Python",
+			goRun:  `[` + goTiming + `]`,
+			python: `[]`,
+			want:   "missing from Python results",
+		},
+	}
+
+	key := benchmarkKey{URL: "example.com", Period: "2023"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair := benchmarkPair{Key: key, Go: fetchBenchmark(t, tt.goRun), Python: fetchBenchmark(t, tt.python)}
+			var want []Discrepancy
+			if tt.want != "" {
+				want = []Discrepancy{{Key: key, Timestamp: "20230101000000", Reason: tt.want}}
+			}
+			if got := findDiscrepancies(pair); !reflect.DeepEqual(got, want) {
+				t.Errorf("discrepancies = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
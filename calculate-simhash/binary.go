@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Compact binary form of CompressedCaptures:
+//
+//	magic   "WBCC" followed by a version byte
+//	hashes  uvarint count, then each SimHash as 8 raw bytes
+//	entries uvarint count, then per capture in compressed order:
+//	        varint seconds since the previous capture (since the Unix
+//	        epoch for the first) and uvarint hash ID
+//
+// Deltas are signed so captures within a day keep their order even when it
+// is not chronological.
+const (
+	binaryCapturesMagic   = "WBCC"
+	binaryCapturesVersion = 1
+	simHashByteSize       = 8
+)
+
+// MarshalBinary encodes the captures in the compact binary form.
+func (c CompressedCaptures) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, len(binaryCapturesMagic)+1+binary.MaxVarintLen64+len(c.Hashes)*simHashByteSize)
+	buf = append(buf, binaryCapturesMagic...)
+	buf = append(buf, binaryCapturesVersion)
+
+	buf = binary.AppendUvarint(buf, uint64(len(c.Hashes)))
+	for i, hash := range c.Hashes {
+		raw, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil || len(raw) != simHashByteSize {
+			return nil, fmt.Errorf("hash %d (%q) is not a base64 encoded %d-byte SimHash", i, hash, simHashByteSize)
+		}
+		buf = append(buf, raw...)
+	}
+
+	count := 0
+	for _, year := range c.Captures {
+		for _, month := range year.Months {
+			for _, day := range month.Days {
+				count += len(day.Captures)
+			}
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(count))
+
+	var previous int64
+	for _, year := range c.Captures {
+		for _, month := range year.Months {
+			for _, day := range month.Days {
+				for _, entry := range day.Captures {
+					seconds, err := captureUnixTime(year.Year, month.Month, day.Day, entry.Time)
+					if err != nil {
+						return nil, err
+					}
+					if entry.HashID < 0 || entry.HashID >= len(c.Hashes) {
+						return nil, fmt.Errorf("capture %04d%02d%02d%s: hash ID %d out of range (%d hashes)",
+							year.Year, month.Month, day.Day, entry.Time, entry.HashID, len(c.Hashes))
+					}
+
+					buf = binary.AppendVarint(buf, seconds-previous)
+					buf = binary.AppendUvarint(buf, uint64(entry.HashID))
+					previous = seconds
+				}
+			}
+		}
+	}
+
+	return buf, nil
+}
+
+// captureUnixTime returns the Unix time of a capture. The time of day must be
+// six digits, so the capture has a full 14-digit timestamp.
+func captureUnixTime(year, month, day int, hms string) (int64, error) {
+	if len(hms) != 6 {
+		ts := fmt.Sprintf("%04d%02d%02d%s", year, month, day, hms)
+		return 0, &TimestampError{Timestamp: ts, Reason: "binary encoding requires 14-digit timestamps"}
+	}
+	hour, errHour := strToInt(hms[0:2])
+	minute, errMinute := strToInt(hms[2:4])
+	second, errSecond := strToInt(hms[4:6])
+	if errHour != nil || errMinute != nil || errSecond != nil ||
+		month < 1 || month > 12 || day < 1 || day > daysIn(year, month) ||
+		hour > 23 || minute > 59 || second > 59 {
+		// Let the parser describe what is wrong.
+		ts := fmt.Sprintf("%04d%02d%02d%s", year, month, day, hms)
+		if _, err := parseWaybackTimestamp(ts); err != nil {
+			return 0, err
+		}
+		return 0, &TimestampError{Timestamp: ts, Reason: "invalid date"}
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC).Unix(), nil
+}
+
+// UnmarshalBinary decodes captures from the compact binary form.
+func (c *CompressedCaptures) UnmarshalBinary(data []byte) error {
+	if len(data) < len(binaryCapturesMagic)+1 || string(data[:len(binaryCapturesMagic)]) != binaryCapturesMagic {
+		return errors.New("not a binary compressed captures payload")
+	}
+	if version := data[len(binaryCapturesMagic)]; version != binaryCapturesVersion {
+		return fmt.Errorf("unsupported binary compressed captures version %d", version)
+	}
+	r := binaryReader{data: data[len(binaryCapturesMagic)+1:]}
+
+	hashCount := r.uvarint()
+	if r.err == nil && hashCount > uint64(len(r.data))/simHashByteSize {
+		return errors.New("binary compressed captures: hash count exceeds payload")
+	}
+	hashes := make([]string, 0, hashCount)
+	for i := uint64(0); i < hashCount && r.err == nil; i++ {
+		hashes = append(hashes, base64.StdEncoding.EncodeToString(r.bytes(simHashByteSize)))
+	}
+
+	entryCount := r.uvarint()
+	captures := []CaptureYear{}
+	var seconds int64
+	for i := uint64(0); i < entryCount && r.err == nil; i++ {
+		seconds += r.varint()
+		hashID := r.uvarint()
+		if r.err != nil {
+			break
+		}
+		if hashID >= uint64(len(hashes)) {
+			return fmt.Errorf("binary compressed captures: hash ID %d out of range (%d hashes)", hashID, len(hashes))
+		}
+
+		t := time.Unix(seconds, 0).UTC()
+		entry := CaptureEntry{Time: t.Format("150405"), HashID: int(hashID)}
+
+		// Captures arrive grouped, so only the last group can be extended.
+		if n := len(captures); n == 0 || captures[n-1].Year != t.Year() {
+			captures = append(captures, CaptureYear{Year: t.Year()})
+		}
+		year := &captures[len(captures)-1]
+		if n := len(year.Months); n == 0 || year.Months[n-1].Month != int(t.Month()) {
+			year.Months = append(year.Months, CaptureMonth{Month: int(t.Month())})
+		}
+		month := &year.Months[len(year.Months)-1]
+		if n := len(month.Days); n == 0 || month.Days[n-1].Day != t.Day() {
+			month.Days = append(month.Days, CaptureDay{Day: t.Day()})
+		}
+		day := &month.Days[len(month.Days)-1]
+		day.Captures = append(day.Captures, entry)
+	}
+	if r.err != nil {
+		return fmt.Errorf("binary compressed captures: %v", r.err)
+	}
+	if len(r.data) > 0 {
+		return fmt.Errorf("binary compressed captures: %d trailing bytes", len(r.data))
+	}
+
+	c.Captures = captures
+	c.Hashes = hashes
+	return nil
+}
+
+// binaryReader reads varints and fixed-size fields, recording the first error.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errors.New("truncated or invalid uvarint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errors.New("truncated or invalid varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errors.New("truncated payload")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
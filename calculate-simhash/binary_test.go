@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	roundTrip := func(captures captureSet) bool {
+		compressed, _ := compressCaptures(captures)
+		data, err := compressed.MarshalBinary()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var decoded CompressedCaptures
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Log(err)
+			return false
+		}
+		return reflect.DeepEqual(decoded, compressed)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBinaryRejectsCorruptPayload(t *testing.T) {
+	compressed, _ := compressCaptures(benchmarkTimeline(100, 10))
+	data, err := compressed.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded CompressedCaptures
+	for _, corrupt := range [][]byte{nil, []byte("WBCC"), data[:len(data)-1], append(data, 0)} {
+		if err := decoded.UnmarshalBinary(corrupt); err == nil {
+			t.Errorf("expected error decoding %d-byte corrupt payload", len(corrupt))
+		}
+	}
+}
+
+// benchmarkTimeline returns n captures a few hours apart, cycling through a
+// dictionary of distinct SimHashes.
+func benchmarkTimeline(n, distinctHashes int) []TimeCapture {
+	r := rand.New(rand.NewSource(1))
+	hashes := make([]string, distinctHashes)
+	for i := range hashes {
+		hashes[i] = base64.StdEncoding.EncodeToString(packSimHashToBytes(r.Uint64()))
+	}
+
+	ts := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+	captures := make([]TimeCapture, n)
+	for i := range captures {
+		ts = ts.Add(time.Duration(r.Intn(6*3600)) * time.Second)
+		captures[i] = TimeCapture{
+			Timestamp: ts.Format(waybackTimestampLayout),
+			SimHash:   hashes[r.Intn(len(hashes))],
+		}
+	}
+	return captures
+}
+
+// benchmarkCompressed is a large timeline shared by the encoding benchmarks.
+func benchmarkCompressed(b *testing.B) CompressedCaptures {
+	b.Helper()
+	compressed, rejected := compressCaptures(benchmarkTimeline(100000, 2000))
+	if len(rejected) > 0 {
+		b.Fatal(rejected[0].Err)
+	}
+	return compressed
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	compressed := benchmarkCompressed(b)
+	var size int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(compressed)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "encoded-bytes")
+}
+
+func BenchmarkEncodeBinary(b *testing.B) {
+	compressed := benchmarkCompressed(b)
+	var size int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := compressed.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "encoded-bytes")
+}
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	data, err := json.Marshal(benchmarkCompressed(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(len(data)), "encoded-bytes")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var decoded CompressedCaptures
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBinary(b *testing.B) {
+	data, err := benchmarkCompressed(b).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(len(data)), "encoded-bytes")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var decoded CompressedCaptures
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
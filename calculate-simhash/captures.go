@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TimeCapture represents a timestamp and its corresponding SimHash.
+type TimeCapture struct {
+	Timestamp string
+	SimHash   string
+}
+
+// CompressedCaptures is the compressed representation of the captures. It
+// encodes to the same JSON as the Python service:
+//
+//	{"captures": [[year, [month, [day, [hms, hashID], ...], ...], ...], ...],
+//	 "hashes": ["base64 simhash", ...]}
+type CompressedCaptures struct {
+	Captures []CaptureYear `json:"captures"`
+	Hashes   []string      `json:"hashes"`
+}
+
+// CaptureYear holds the captures of one year, grouped by month.
+type CaptureYear struct {
+	Year   int
+	Months []CaptureMonth
+}
+
+// CaptureMonth holds the captures of one month, grouped by day.
+type CaptureMonth struct {
+	Month int
+	Days  []CaptureDay
+}
+
+// CaptureDay holds the captures of one day.
+type CaptureDay struct {
+	Day      int
+	Captures []CaptureEntry
+}
+
+// CaptureEntry is a single capture: the time of day as written in the
+// timestamp (usually HHMMSS) and the index of its SimHash in Hashes.
+type CaptureEntry struct {
+	Time   string
+	HashID int
+}
+
+// waybackTimestampLayout is the time layout of a 14-digit Wayback timestamp.
+const waybackTimestampLayout = "20060102150405"
+
+// TimestampError reports a capture timestamp that is not a valid Wayback
+// timestamp.
+type TimestampError struct {
+	Timestamp string
+	Reason    string
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("invalid timestamp %q: %s", e.Timestamp, e.Reason)
+}
+
+// RejectedCapture is a capture that compressCaptures left out, with the reason.
+type RejectedCapture struct {
+	Capture TimeCapture
+	Err     error
+}
+
+// waybackTimestamp is a parsed Wayback timestamp. Time is always six digits.
+type waybackTimestamp struct {
+	Year  int
+	Month int
+	Day   int
+	Time  string
+}
+
+// parseWaybackTimestamp validates a Wayback timestamp of 4 to 14 digits. The
+// CDX server returns shorter precisions such as yyyy, yyyyMM or yyyyMMddhh;
+// missing fields take their earliest value, so "202306" is read as
+// 20230601000000.
+func parseWaybackTimestamp(ts string) (waybackTimestamp, error) {
+	var parsed waybackTimestamp
+
+	if len(ts) < 4 || len(ts) > 14 || len(ts)%2 != 0 {
+		return parsed, &TimestampError{Timestamp: ts, Reason: "expected 4, 6, 8, 10, 12 or 14 digits"}
+	}
+	if _, err := strToInt(ts); err != nil {
+		return parsed, &TimestampError{Timestamp: ts, Reason: err.Error()}
+	}
+
+	full := ts + "0101000000"[len(ts)-4:]
+	parsed.Year, _ = strToInt(full[0:4])
+	parsed.Month, _ = strToInt(full[4:6])
+	parsed.Day, _ = strToInt(full[6:8])
+	parsed.Time = full[8:14]
+	hour, _ := strToInt(full[8:10])
+	minute, _ := strToInt(full[10:12])
+	second, _ := strToInt(full[12:14])
+
+	switch {
+	case parsed.Month < 1 || parsed.Month > 12:
+		return parsed, &TimestampError{Timestamp: ts, Reason: fmt.Sprintf("month %d out of range", parsed.Month)}
+	case parsed.Day < 1 || parsed.Day > daysIn(parsed.Year, parsed.Month):
+		return parsed, &TimestampError{Timestamp: ts, Reason: fmt.Sprintf("day %d out of range", parsed.Day)}
+	case hour > 23:
+		return parsed, &TimestampError{Timestamp: ts, Reason: fmt.Sprintf("hour %d out of range", hour)}
+	case minute > 59:
+		return parsed, &TimestampError{Timestamp: ts, Reason: fmt.Sprintf("minute %d out of range", minute)}
+	case second > 59:
+		return parsed, &TimestampError{Timestamp: ts, Reason: fmt.Sprintf("second %d out of range", second)}
+	}
+
+	return parsed, nil
+}
+
+// daysIn returns the number of days in the month of the given year.
+func daysIn(year, month int) int {
+	return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// MarshalJSON writes the whole structure into one buffer. Going through the
+// per-level MarshalJSON methods instead would make encoding/json box every
+// node and re-compact each nested result, which is several times slower.
+func (c CompressedCaptures) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"captures":`)
+	if c.Captures == nil {
+		buf.WriteString("null")
+	} else {
+		buf.WriteByte('[')
+		for i, y := range c.Captures {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			y.writeJSON(&buf)
+		}
+		buf.WriteByte(']')
+	}
+
+	hashes, err := json.Marshal(c.Hashes)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(`,"hashes":`)
+	buf.Write(hashes)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON encodes the year as [year, month...].
+func (y CaptureYear) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	y.writeJSON(&buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a year from [year, month...].
+func (y *CaptureYear) UnmarshalJSON(data []byte) error {
+	var err error
+	y.Year, y.Months, err = unmarshalGroup[CaptureMonth](data, "year")
+	return err
+}
+
+// MarshalJSON encodes the month as [month, day...].
+func (m CaptureMonth) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	m.writeJSON(&buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a month from [month, day...].
+func (m *CaptureMonth) UnmarshalJSON(data []byte) error {
+	var err error
+	m.Month, m.Days, err = unmarshalGroup[CaptureDay](data, "month")
+	return err
+}
+
+// MarshalJSON encodes the day as [day, entry...].
+func (d CaptureDay) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	d.writeJSON(&buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a day from [day, entry...].
+func (d *CaptureDay) UnmarshalJSON(data []byte) error {
+	var err error
+	d.Day, d.Captures, err = unmarshalGroup[CaptureEntry](data, "day")
+	return err
+}
+
+// MarshalJSON encodes the entry as [time, hashID].
+func (e CaptureEntry) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.writeJSON(&buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes an entry from [time, hashID].
+func (e *CaptureEntry) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("capture entry: %v", err)
+	}
+	if len(fields) != 2 {
+		return fmt.Errorf("capture entry: expected [time, hashID], got %d elements", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return fmt.Errorf("capture entry time: %v", err)
+	}
+	if err := json.Unmarshal(fields[1], &e.HashID); err != nil {
+		return fmt.Errorf("capture entry hash ID: %v", err)
+	}
+	return nil
+}
+
+// writeJSON writes [year, month...] to buf.
+func (y CaptureYear) writeJSON(buf *bytes.Buffer) {
+	writeGroupKey(buf, y.Year)
+	for _, m := range y.Months {
+		buf.WriteByte(',')
+		m.writeJSON(buf)
+	}
+	buf.WriteByte(']')
+}
+
+// writeJSON writes [month, day...] to buf.
+func (m CaptureMonth) writeJSON(buf *bytes.Buffer) {
+	writeGroupKey(buf, m.Month)
+	for _, d := range m.Days {
+		buf.WriteByte(',')
+		d.writeJSON(buf)
+	}
+	buf.WriteByte(']')
+}
+
+// writeJSON writes [day, entry...] to buf.
+func (d CaptureDay) writeJSON(buf *bytes.Buffer) {
+	writeGroupKey(buf, d.Day)
+	for _, e := range d.Captures {
+		buf.WriteByte(',')
+		e.writeJSON(buf)
+	}
+	buf.WriteByte(']')
+}
+
+// writeJSON writes [time, hashID] to buf.
+func (e CaptureEntry) writeJSON(buf *bytes.Buffer) {
+	buf.WriteByte('[')
+	writeJSONString(buf, e.Time)
+	buf.WriteByte(',')
+	buf.WriteString(strconv.Itoa(e.HashID))
+	buf.WriteByte(']')
+}
+
+// writeGroupKey opens a group array and writes its key.
+func writeGroupKey(buf *bytes.Buffer, key int) {
+	buf.WriteByte('[')
+	buf.WriteString(strconv.Itoa(key))
+}
+
+// writeJSONString writes s as a JSON string. Capture times are digits and are
+// written directly; anything else goes through encoding/json for escaping.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			quoted, _ := json.Marshal(s)
+			buf.Write(quoted)
+			return
+		}
+	}
+	buf.WriteByte('"')
+	buf.WriteString(s)
+	buf.WriteByte('"')
+}
+
+// unmarshalGroup decodes a flat JSON array of a key followed by its children.
+func unmarshalGroup[T any](data []byte, level string) (int, []T, error) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return 0, nil, fmt.Errorf("capture %s: %v", level, err)
+	}
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("capture %s: empty array", level)
+	}
+
+	var key int
+	if err := json.Unmarshal(fields[0], &key); err != nil {
+		return 0, nil, fmt.Errorf("capture %s: %v", level, err)
+	}
+
+	children := make([]T, len(fields)-1)
+	for i, field := range fields[1:] {
+		if err := json.Unmarshal(field, &children[i]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return key, children, nil
+}
+
+// CompressOptions controls how compressCapturesWithOptions builds the hash
+// dictionary.
+type CompressOptions struct {
+	// HammingThreshold, when positive, maps a SimHash to the ID of an earlier
+	// hash within this many differing bits instead of assigning a new ID.
+	// Zero keeps one ID per distinct hash.
+	HammingThreshold int
+}
+
+// compressCaptures compresses timestamp and SimHash pairs. Timestamps shorter
+// than 14 digits are padded as described in parseWaybackTimestamp. Captures
+// with malformed timestamps are left out and returned as rejections.
+func compressCaptures(captures []TimeCapture) (CompressedCaptures, []RejectedCapture) {
+	return compressCapturesWithOptions(captures, CompressOptions{})
+}
+
+// compressCapturesWithOptions is like compressCaptures but assigns hash IDs as
+// described by opts.
+func compressCapturesWithOptions(captures []TimeCapture, opts CompressOptions) (CompressedCaptures, []RejectedCapture) {
+	hashDict := newHashDictionary(opts.HammingThreshold)
+	grouped := make(map[int]map[int]map[int][]CaptureEntry)
+	var rejected []RejectedCapture
+
+	for _, capture := range captures {
+		simHash := capture.SimHash
+
+		// Parse timestamp components.
+		ts, err := parseWaybackTimestamp(capture.Timestamp)
+		if err != nil {
+			rejected = append(rejected, RejectedCapture{Capture: capture, Err: err})
+			continue
+		}
+		year, month, day, hms := ts.Year, ts.Month, ts.Day, ts.Time
+
+		// Get or assign hash ID.
+		hashID := hashDict.id(simHash)
+
+		// Create nested maps if they don't exist.
+		if _, exists := grouped[year]; !exists {
+			grouped[year] = make(map[int]map[int][]CaptureEntry)
+		}
+		if _, exists := grouped[year][month]; !exists {
+			grouped[year][month] = make(map[int][]CaptureEntry)
+		}
+
+		// Add capture.
+		grouped[year][month][day] = append(grouped[year][month][day], CaptureEntry{Time: hms, HashID: hashID})
+	}
+
+	// Build compressed captures. Empty slices encode as [] like the Python
+	// service rather than null.
+	compressedCaptures := CompressedCaptures{
+		Captures: []CaptureYear{},
+		Hashes:   hashDict.hashes,
+	}
+
+	// Build the nested structure in sorted order.
+	for _, year := range sortedKeys(grouped) {
+		yearData := CaptureYear{Year: year}
+
+		for _, month := range sortedKeys(grouped[year]) {
+			monthData := CaptureMonth{Month: month}
+
+			for _, day := range sortedKeys(grouped[year][month]) {
+				monthData.Days = append(monthData.Days, CaptureDay{
+					Day:      day,
+					Captures: grouped[year][month][day],
+				})
+			}
+
+			yearData.Months = append(yearData.Months, monthData)
+		}
+
+		compressedCaptures.Captures = append(compressedCaptures.Captures, yearData)
+	}
+
+	return compressedCaptures, rejected
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// strToInt converts string to int safely.
+func strToInt(s string) (int, error) {
+	var result int
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid digit: %c", c)
+		}
+		result = result*10 + int(c-'0')
+	}
+	return result, nil
+}
+
+// decompressCaptures expands compressed captures into timestamp and SimHash
+// pairs sorted by timestamp. Each timestamp is rebuilt as yyyyMMdd followed by
+// the capture's time of day, giving full 14-digit timestamps. Captures with
+// equal timestamps keep their compressed order.
+func decompressCaptures(compressed CompressedCaptures) ([]TimeCapture, error) {
+	var captures []TimeCapture
+
+	for _, year := range compressed.Captures {
+		for _, month := range year.Months {
+			for _, day := range month.Days {
+				for _, entry := range day.Captures {
+					if entry.HashID < 0 || entry.HashID >= len(compressed.Hashes) {
+						return nil, fmt.Errorf("capture %04d%02d%02d%s: hash ID %d out of range (%d hashes)",
+							year.Year, month.Month, day.Day, entry.Time, entry.HashID, len(compressed.Hashes))
+					}
+					captures = append(captures, TimeCapture{
+						Timestamp: fmt.Sprintf("%04d%02d%02d%s", year.Year, month.Month, day.Day, entry.Time),
+						SimHash:   compressed.Hashes[entry.HashID],
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(captures, func(i, j int) bool {
+		return captures[i].Timestamp < captures[j].Timestamp
+	})
+
+	return captures, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// captureSet is a random set of captures with valid 14-digit timestamps. Hashes
+// are drawn from a small pool so captures share hash IDs.
+type captureSet []TimeCapture
+
+// Generate implements quick.Generator.
+func (captureSet) Generate(r *rand.Rand, size int) reflect.Value {
+	hashes := make([]string, 1+r.Intn(8))
+	for i := range hashes {
+		hashes[i] = base64.StdEncoding.EncodeToString(packSimHashToBytes(r.Uint64()))
+	}
+
+	start := time.Date(1996, time.January, 1, 0, 0, 0, 0, time.UTC)
+	span := int64(30 * 365 * 24 * time.Hour / time.Second)
+
+	captures := make(captureSet, r.Intn(size+1))
+	for i := range captures {
+		ts := start.Add(time.Duration(r.Int63n(span)) * time.Second)
+		if i > 0 && r.Intn(4) == 0 {
+			// Land near an earlier capture to exercise grouping within a day.
+			prev, _ := time.Parse(waybackTimestampLayout, captures[r.Intn(i)].Timestamp)
+			ts = prev.Add(time.Duration(r.Intn(3600)) * time.Second)
+		}
+		captures[i] = TimeCapture{
+			Timestamp: ts.Format(waybackTimestampLayout),
+			SimHash:   hashes[r.Intn(len(hashes))],
+		}
+	}
+	return reflect.ValueOf(captures)
+}
+
+// sameCaptures reports whether got holds the captures of want in stable
+// timestamp order.
+func sameCaptures(got, want []TimeCapture) bool {
+	sorted := append([]TimeCapture(nil), want...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+	if len(got) == 0 && len(sorted) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(got, sorted)
+}
+
+func TestCompressDecompressRoundTrip(t *testing.T) {
+	roundTrip := func(captures captureSet) bool {
+		compressed, rejected := compressCaptures(captures)
+		if len(rejected) > 0 {
+			t.Log(rejected[0].Err)
+			return false
+		}
+		decompressed, err := decompressCaptures(compressed)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		return sameCaptures(decompressed, captures)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompressDecompressJSONRoundTrip(t *testing.T) {
+	roundTrip := func(captures captureSet) bool {
+		compressed, _ := compressCaptures(captures)
+		data, err := json.Marshal(compressed)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var decoded CompressedCaptures
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Log(err)
+			return false
+		}
+		decompressed, err := decompressCaptures(decoded)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		return sameCaptures(decompressed, captures)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompressedCapturesWireFormat(t *testing.T) {
+	compressed, _ := compressCaptures([]TimeCapture{
+		{Timestamp: "20230101130000", SimHash: "b"},
+		{Timestamp: "20230101120000", SimHash: "a"},
+		{Timestamp: "20220615000001", SimHash: "b"},
+	})
+
+	data, err := json.Marshal(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"captures":[[2022,[6,[15,["000001",0]]]],[2023,[1,[1,["130000",0],["120000",1]]]]],"hashes":["b","a"]}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
+
+func TestDecompressCapturesRejectsUnknownHashID(t *testing.T) {
+	compressed := CompressedCaptures{
+		Captures: []CaptureYear{{Year: 2023, Months: []CaptureMonth{{Month: 1, Days: []CaptureDay{{Day: 1, Captures: []CaptureEntry{{Time: "000000", HashID: 1}}}}}}}},
+		Hashes:   []string{"a"},
+	}
+	if _, err := decompressCaptures(compressed); err == nil {
+		t.Error("expected error for out-of-range hash ID")
+	}
+}
+
+func TestCompressCapturesShortPrecision(t *testing.T) {
+	compressed, rejected := compressCaptures([]TimeCapture{
+		{Timestamp: "2023", SimHash: "a"},
+		{Timestamp: "202306", SimHash: "a"},
+		{Timestamp: "20230615", SimHash: "a"},
+		{Timestamp: "2023061512", SimHash: "a"},
+		{Timestamp: "202306151230", SimHash: "a"},
+	})
+	if len(rejected) > 0 {
+		t.Fatalf("unexpected rejection: %v", rejected[0].Err)
+	}
+
+	captures, err := decompressCaptures(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20230101000000", "20230601000000", "20230615000000", "20230615120000", "20230615123000"}
+	if len(captures) != len(want) {
+		t.Fatalf("got %d captures, want %d", len(captures), len(want))
+	}
+	for i, capture := range captures {
+		if capture.Timestamp != want[i] {
+			t.Errorf("capture %d: got %s, want %s", i, capture.Timestamp, want[i])
+		}
+	}
+}
+
+func TestCompressCapturesRejectsMalformedTimestamps(t *testing.T) {
+	malformed := []string{"", "202", "20230", "2023x1", "202313", "20230230", "2023010124", "202301011260", "20230101120060", "202301011200001"}
+
+	captures := []TimeCapture{{Timestamp: "20230101000000", SimHash: "a"}}
+	for _, ts := range malformed {
+		captures = append(captures, TimeCapture{Timestamp: ts, SimHash: "b"})
+	}
+
+	compressed, rejected := compressCaptures(captures)
+	if len(rejected) != len(malformed) {
+		t.Fatalf("got %d rejections, want %d", len(rejected), len(malformed))
+	}
+	for i, r := range rejected {
+		var tsErr *TimestampError
+		if !errors.As(r.Err, &tsErr) || tsErr.Timestamp != malformed[i] {
+			t.Errorf("rejection %d: got %v, want TimestampError for %q", i, r.Err, malformed[i])
+		}
+	}
+	if len(compressed.Hashes) != 1 || compressed.Hashes[0] != "a" {
+		t.Errorf("got hashes %v, want only the valid capture's hash", compressed.Hashes)
+	}
+}
+
+func TestCaptureStreamEncoderMatchesCompressCaptures(t *testing.T) {
+	matches := func(captures captureSet) bool {
+		sorted := append([]TimeCapture(nil), captures...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Timestamp < sorted[j].Timestamp
+		})
+
+		var streamed bytes.Buffer
+		encoder := NewCaptureStreamEncoder(&streamed)
+		for _, capture := range sorted {
+			if err := encoder.Add(capture); err != nil {
+				t.Log(err)
+				return false
+			}
+		}
+		if err := encoder.Close(); err != nil {
+			t.Log(err)
+			return false
+		}
+
+		compressed, _ := compressCaptures(sorted)
+		want, err := json.Marshal(compressed)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		return bytes.Equal(streamed.Bytes(), want)
+	}
+	if err := quick.Check(matches, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCaptureStreamEncoderRejectsOutOfOrder(t *testing.T) {
+	var out bytes.Buffer
+	encoder := NewCaptureStreamEncoder(&out)
+	if err := encoder.Add(TimeCapture{Timestamp: "20230102000000", SimHash: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Add(TimeCapture{Timestamp: "20230101000000", SimHash: "a"}); err == nil {
+		t.Error("expected error for capture out of order")
+	}
+	if err := encoder.Add(TimeCapture{Timestamp: "2023010", SimHash: "a"}); err == nil {
+		t.Error("expected error for malformed timestamp")
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"captures":[[2023,[1,[2,["000000",0]]]]],"hashes":["a"]}`; out.String() != want {
+		t.Errorf("got %s, want %s", out.String(), want)
+	}
+}
+
+func TestCompressCapturesClustersNearDuplicates(t *testing.T) {
+	encode := func(v uint64) string {
+		return base64.StdEncoding.EncodeToString(packSimHashToBytes(v))
+	}
+	base := uint64(0xF0F0F0F0F0F0F0F0)
+	captures := []TimeCapture{
+		{Timestamp: "20230101000000", SimHash: encode(base)},
+		{Timestamp: "20230102000000", SimHash: encode(base ^ 0x1)},  // 1 bit
+		{Timestamp: "20230103000000", SimHash: encode(base ^ 0x7)},  // 3 bits
+		{Timestamp: "20230104000000", SimHash: encode(^base)},       // 64 bits
+		{Timestamp: "20230105000000", SimHash: encode(^base ^ 0x3)}, // 2 bits from the previous hash
+		{Timestamp: "20230106000000", SimHash: "not a simhash"},
+	}
+
+	exact, _ := compressCaptures(captures)
+	if len(exact.Hashes) != len(captures) {
+		t.Errorf("exact: got %d hashes, want %d", len(exact.Hashes), len(captures))
+	}
+
+	clustered, _ := compressCapturesWithOptions(captures, CompressOptions{HammingThreshold: 2})
+	want := []string{encode(base), encode(base ^ 0x7), encode(^base), "not a simhash"}
+	if !reflect.DeepEqual(clustered.Hashes, want) {
+		t.Errorf("clustered hashes: got %v, want %v", clustered.Hashes, want)
+	}
+
+	decompressed, err := decompressCaptures(clustered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs := []string{want[0], want[0], want[1], want[2], want[2], want[3]}
+	for i, capture := range decompressed {
+		if capture.SimHash != wantIDs[i] {
+			t.Errorf("capture %d: got hash %s, want representative %s", i, capture.SimHash, wantIDs[i])
+		}
+	}
+}
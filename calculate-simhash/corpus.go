@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mfonda/simhash"
+)
+
+// CorpusConfig represents the synthetic corpus generator configuration.
+type CorpusConfig struct {
+	OutputDir string
+	Seed      int64
+	Documents int
+	// Words is the number of words in the body of each page.
+	Words int
+	// Vocabulary is the number of distinct words pages are drawn from.
+	Vocabulary int
+	// MutationRate is the fraction of words replaced between two
+	// consecutive versions of a page.
+	MutationRate float64
+	// Versions is the number of versions written per page, including the
+	// original.
+	Versions int
+}
+
+// VersionValidation compares every page version with the original version.
+type VersionValidation struct {
+	Version int
+	// InjectedEditRate is the expected fraction of words differing from the
+	// original, 1-(1-MutationRate)^Version.
+	InjectedEditRate float64
+	// MeasuredEditRate is the mean fraction of word positions that differ
+	// from the original.
+	MeasuredEditRate float64
+	// MeanHammingDistance is the mean SimHash Hamming distance to the original.
+	MeanHammingDistance float64
+}
+
+// CorpusValidation reports how SimHash distances track the injected edits.
+type CorpusValidation struct {
+	Versions []VersionValidation
+	// Correlation is the Pearson correlation between the per-page measured
+	// edit rate and Hamming distance over all versions.
+	Correlation float64
+}
+
+// corpusGenerator produces reproducible pages from a seeded source.
+type corpusGenerator struct {
+	config CorpusConfig
+	rng    *rand.Rand
+	zipf   *rand.Zipf
+	vocab  []string
+}
+
+// newCorpusGenerator builds the vocabulary for config. The same seed always
+// produces the same vocabulary and pages.
+func newCorpusGenerator(config CorpusConfig) *corpusGenerator {
+	rng := rand.New(rand.NewSource(config.Seed))
+	g := &corpusGenerator{
+		config: config,
+		rng:    rng,
+		// Word frequencies in natural text roughly follow Zipf's law.
+		zipf:  rand.NewZipf(rng, 1.1, 1, uint64(config.Vocabulary-1)),
+		vocab: make([]string, config.Vocabulary),
+	}
+
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	for i := range g.vocab {
+		word := make([]byte, 3+rng.Intn(8))
+		for j := range word {
+			word[j] = letters[rng.Intn(len(letters))]
+		}
+		g.vocab[i] = string(word)
+	}
+	return g
+}
+
+// word draws one word from the vocabulary.
+func (g *corpusGenerator) word() string {
+	return g.vocab[g.zipf.Uint64()]
+}
+
+// page draws the words of a new page.
+func (g *corpusGenerator) page() []string {
+	words := make([]string, g.config.Words)
+	for i := range words {
+		words[i] = g.word()
+	}
+	return words
+}
+
+// mutate returns a copy of words with each word replaced by a random word
+// with probability MutationRate.
+func (g *corpusGenerator) mutate(words []string) []string {
+	mutated := append([]string(nil), words...)
+	for i := range mutated {
+		if g.rng.Float64() < g.config.MutationRate {
+			mutated[i] = g.word()
+		}
+	}
+	return mutated
+}
+
+// renderHTML wraps words in a page skeleton. Script and style content is
+// included so feature extraction has something to strip.
+func renderHTML(title string, words []string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	b.WriteString("<style>body { font-family: sans-serif; }</style>\n")
+	b.WriteString("<script>var generated = true;</script>\n")
+	b.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+
+	const paragraphWords = 60
+	for start := 0; start < len(words); start += paragraphWords {
+		end := min(start+paragraphWords, len(words))
+		fmt.Fprintf(&b, "<p>%s.</p>\n", strings.Join(words[start:end], " "))
+	}
+
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// generateCorpus writes Documents pages with Versions versions each to
+// OutputDir and validates the SimHash distances of the generated versions.
+func generateCorpus(config CorpusConfig) (CorpusValidation, error) {
+	validation := CorpusValidation{}
+
+	if config.Documents < 1 || config.Words < 1 || config.Versions < 1 {
+		return validation, fmt.Errorf("documents, words and versions must be positive")
+	}
+	if config.Vocabulary < 2 {
+		return validation, fmt.Errorf("vocabulary must contain at least 2 words")
+	}
+	if config.MutationRate < 0 || config.MutationRate > 1 {
+		return validation, fmt.Errorf("mutation rate must be between 0 and 1")
+	}
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return validation, fmt.Errorf("failed to create corpus directory %s: %v", config.OutputDir, err)
+	}
+
+	g := newCorpusGenerator(config)
+
+	validation.Versions = make([]VersionValidation, config.Versions)
+	var editRates, distances []float64
+
+	for doc := 0; doc < config.Documents; doc++ {
+		words := g.page()
+		original := words
+		var originalHash uint64
+
+		for version := 0; version < config.Versions; version++ {
+			if version > 0 {
+				words = g.mutate(words)
+			}
+
+			title := fmt.Sprintf("Document %d", doc)
+			content := renderHTML(title, words)
+			path := filepath.Join(config.OutputDir, fmt.Sprintf("doc%05d_v%d.html", doc, version))
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return validation, fmt.Errorf("failed to write %s: %v", path, err)
+			}
+
+			features, err := extractHTMLFeatures(content)
+			if err != nil {
+				return validation, fmt.Errorf("failed to extract features from %s: %v", path, err)
+			}
+			hash := calculateSimHash(features, 64)
+			if version == 0 {
+				originalHash = hash
+			}
+
+			changed := 0
+			for i := range words {
+				if words[i] != original[i] {
+					changed++
+				}
+			}
+			editRate := float64(changed) / float64(len(words))
+			distance := float64(simhash.Compare(originalHash, hash))
+
+			v := &validation.Versions[version]
+			v.Version = version
+			v.InjectedEditRate = 1 - math.Pow(1-config.MutationRate, float64(version))
+			v.MeasuredEditRate += editRate / float64(config.Documents)
+			v.MeanHammingDistance += distance / float64(config.Documents)
+
+			if version > 0 {
+				editRates = append(editRates, editRate)
+				distances = append(distances, distance)
+			}
+		}
+	}
+
+	validation.Correlation = pearsonCorrelation(editRates, distances)
+	return validation, nil
+}
+
+// pearsonCorrelation returns the Pearson correlation coefficient of xs and ys,
+// or NaN when either has no variance.
+func pearsonCorrelation(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	if n == 0 {
+		return math.NaN()
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i] / n
+		meanY += ys[i] / n
+	}
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varX*varY)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testCorpusConfig returns a small corpus configuration writing to dir.
+func testCorpusConfig(dir string) CorpusConfig {
+	return CorpusConfig{
+		OutputDir:    dir,
+		Seed:         42,
+		Documents:    8,
+		Words:        300,
+		Vocabulary:   500,
+		MutationRate: 0.1,
+		Versions:     4,
+	}
+}
+
+// readCorpus returns the contents of every file in dir by name.
+func readCorpus(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = data
+	}
+	return files
+}
+
+func TestGenerateCorpusIsReproducible(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	firstValidation, err := generateCorpus(testCorpusConfig(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondValidation, err := generateCorpus(testCorpusConfig(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstFiles, secondFiles := readCorpus(t, first), readCorpus(t, second)
+	config := testCorpusConfig(first)
+	if len(firstFiles) != config.Documents*config.Versions {
+		t.Fatalf("got %d files, want %d", len(firstFiles), config.Documents*config.Versions)
+	}
+	for name, data := range firstFiles {
+		if !bytes.Equal(data, secondFiles[name]) {
+			t.Errorf("%s differs between runs with the same seed", name)
+		}
+	}
+	if !reflect.DeepEqual(firstValidation, secondValidation) {
+		t.Errorf("validation differs between runs with the same seed:\n%+v\n%+v", firstValidation, secondValidation)
+	}
+
+	other := testCorpusConfig(t.TempDir())
+	other.Seed++
+	if _, err := generateCorpus(other); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(readCorpus(t, other.OutputDir), firstFiles) {
+		t.Error("a different seed produced the same corpus")
+	}
+}
+
+func TestGenerateCorpusValidation(t *testing.T) {
+	validation, err := generateCorpus(testCorpusConfig(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions := validation.Versions
+	if len(versions) != 4 {
+		t.Fatalf("got %d versions, want 4", len(versions))
+	}
+	if v := versions[0]; v.MeasuredEditRate != 0 || v.MeanHammingDistance != 0 {
+		t.Errorf("original version has edit rate %f and distance %f, want 0", v.MeasuredEditRate, v.MeanHammingDistance)
+	}
+	for i := 1; i < len(versions); i++ {
+		prev, v := versions[i-1], versions[i]
+		if v.MeasuredEditRate <= prev.MeasuredEditRate {
+			t.Errorf("version %d edit rate %f does not exceed version %d's %f", i, v.MeasuredEditRate, i-1, prev.MeasuredEditRate)
+		}
+		if v.MeanHammingDistance <= prev.MeanHammingDistance {
+			t.Errorf("version %d Hamming distance %f does not exceed version %d's %f", i, v.MeanHammingDistance, i-1, prev.MeanHammingDistance)
+		}
+	}
+	if validation.Correlation <= 0 {
+		t.Errorf("correlation = %f, want positive", validation.Correlation)
+	}
+}
+
+func TestGenerateCorpusRejectsInvalidConfig(t *testing.T) {
+	for _, modify := range []func(*CorpusConfig){
+		func(c *CorpusConfig) { c.Documents = 0 },
+		func(c *CorpusConfig) { c.Vocabulary = 1 },
+		func(c *CorpusConfig) { c.MutationRate = 1.5 },
+	} {
+		config := testCorpusConfig(t.TempDir())
+		modify(&config)
+		if _, err := generateCorpus(config); err == nil {
+			t.Errorf("generateCorpus(%+v) succeeded, want error", config)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+
+	"github.com/mfonda/simhash"
+)
+
+// hashDictionary assigns IDs to SimHashes in order of first appearance. With
+// a positive threshold, hashes are clustered: a new hash within threshold
+// bits of an existing representative shares its ID, and only representatives
+// are kept in the dictionary. A representative is the first hash seen in its
+// cluster, so clusters depend on the order hashes are added.
+type hashDictionary struct {
+	threshold int
+	ids       map[string]int
+	hashes    []string
+	// values holds the decoded representatives, indexed by ID, when
+	// clustering. Hashes that are not base64 encoded 64-bit SimHashes only
+	// match exactly.
+	values []uint64
+	valid  []bool
+}
+
+// newHashDictionary returns an empty dictionary clustering hashes within
+// threshold bits of each other. A threshold of zero matches hashes exactly.
+func newHashDictionary(threshold int) *hashDictionary {
+	return &hashDictionary{
+		threshold: threshold,
+		ids:       make(map[string]int),
+		hashes:    []string{},
+	}
+}
+
+// id returns the ID of simHash, assigning the next free ID to new hashes that
+// do not fall within the threshold of an existing representative.
+func (d *hashDictionary) id(simHash string) int {
+	if id, exists := d.ids[simHash]; exists {
+		return id
+	}
+
+	if d.threshold > 0 {
+		value, ok := decodeSimHash(simHash)
+		if ok {
+			if id, found := d.nearest(value); found {
+				d.ids[simHash] = id
+				return id
+			}
+		}
+		d.values = append(d.values, value)
+		d.valid = append(d.valid, ok)
+	}
+
+	id := len(d.hashes)
+	d.ids[simHash] = id
+	d.hashes = append(d.hashes, simHash)
+	return id
+}
+
+// nearest returns the ID of the closest representative within the threshold,
+// preferring the lowest ID on ties.
+func (d *hashDictionary) nearest(value uint64) (int, bool) {
+	best, bestDistance := -1, d.threshold+1
+	for id, representative := range d.values {
+		if !d.valid[id] {
+			continue
+		}
+		if distance := int(simhash.Compare(value, representative)); distance < bestDistance {
+			best, bestDistance = id, distance
+		}
+	}
+	return best, best >= 0
+}
+
+// decodeSimHash reverses the base64 encoding of packSimHashToBytes.
+func decodeSimHash(simHash string) (uint64, bool) {
+	raw, err := base64.StdEncoding.DecodeString(simHash)
+	if err != nil || len(raw) != 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(raw), true
+}
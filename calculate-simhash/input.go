@@ -0,0 +1,255 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// document is one HTML document to benchmark. Plain files are read by the
+// worker that processes them, so Data is nil. Documents stored in gzip, tar
+// or WARC files are decoded while the archive is scanned and carry their
+// content along with the time it took to read them.
+type document struct {
+	Name     string
+	Path     string
+	Data     []byte
+	ReadTime float64
+}
+
+// listInputFiles returns the paths of the regular files in folderPath, sorted
+// by name.
+func listInputFiles(folderPath string) ([]string, error) {
+	entries, err := os.ReadDir(folderPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory %s: %v", folderPath, err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		paths = append(paths, filepath.Join(folderPath, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// readDocuments passes every document stored in the file at path to emit,
+// choosing the reader from the file extension. Scanning stops early when emit
+// returns false.
+func readDocuments(path string, emit func(document) bool) error {
+	name := filepath.Base(path)
+	lower := strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(lower, ".warc"), strings.HasSuffix(lower, ".warc.gz"):
+		return readArchive(path, func(r io.Reader) error {
+			return readWARCDocuments(r, name, emit)
+		})
+	case strings.HasSuffix(lower, ".tar"), strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return readArchive(path, func(r io.Reader) error {
+			return readTarDocuments(r, name, emit)
+		})
+	case strings.HasSuffix(lower, ".gz"):
+		startTime := time.Now()
+		var data []byte
+		err := readArchive(path, func(r io.Reader) error {
+			var err error
+			data, err = io.ReadAll(r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		emit(document{Name: name, Path: path, Data: data, ReadTime: time.Since(startTime).Seconds()})
+		return nil
+	default:
+		emit(document{Name: name, Path: path})
+		return nil
+	}
+}
+
+// readArchive opens the file at path, transparently decompressing gzip files,
+// and passes the content to read.
+func readArchive(path string, read func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		// Multi-member gzip files such as .warc.gz are read as one stream.
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := read(r); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return nil
+}
+
+// readTarDocuments emits each regular file in a tar archive as a document.
+// Entries ending in .gz are decompressed.
+func readTarDocuments(r io.Reader, archiveName string, emit func(document) bool) error {
+	tr := tar.NewReader(r)
+	for {
+		startTime := time.Now()
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		var entry io.Reader = tr
+		if strings.HasSuffix(strings.ToLower(header.Name), ".gz") {
+			gz, err := gzip.NewReader(tr)
+			if err != nil {
+				return fmt.Errorf("failed to decompress %s: %v", header.Name, err)
+			}
+			entry = gz
+		}
+
+		data, err := io.ReadAll(entry)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", header.Name, err)
+		}
+
+		doc := document{
+			Name:     archiveName + "/" + header.Name,
+			Data:     data,
+			ReadTime: time.Since(startTime).Seconds(),
+		}
+		if !emit(doc) {
+			return nil
+		}
+	}
+}
+
+// readWARCDocuments emits the body of each HTML response record in a WARC
+// stream as a document. Other records are skipped.
+func readWARCDocuments(r io.Reader, archiveName string, emit func(document) bool) error {
+	br := bufio.NewReader(r)
+	tp := textproto.NewReader(br)
+	index := 0
+
+	for {
+		startTime := time.Now()
+
+		// Records are separated by blank lines before the version line.
+		var version string
+		for {
+			line, err := tp.ReadLine()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if line != "" {
+				version = line
+				break
+			}
+		}
+		if !strings.HasPrefix(version, "WARC/") {
+			return fmt.Errorf("expected WARC version line, got %q", version)
+		}
+
+		headers, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return fmt.Errorf("failed to read WARC headers: %v", err)
+		}
+		length, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid WARC Content-Length %q: %v", headers.Get("Content-Length"), err)
+		}
+
+		block := io.LimitReader(br, length)
+		data, isHTML, err := readWARCResponse(headers, block)
+		if err != nil {
+			return fmt.Errorf("failed to read WARC record %s: %v", headers.Get("WARC-Record-ID"), err)
+		}
+		// Skip whatever the record parser did not consume.
+		if _, err := io.Copy(io.Discard, block); err != nil {
+			return err
+		}
+
+		if !isHTML {
+			continue
+		}
+
+		doc := document{
+			Name:     fmt.Sprintf("%s#%06d %s", archiveName, index, headers.Get("WARC-Target-URI")),
+			Data:     data,
+			ReadTime: time.Since(startTime).Seconds(),
+		}
+		index++
+		if !emit(doc) {
+			return nil
+		}
+	}
+}
+
+// readWARCResponse returns the decoded HTTP body of a WARC response record
+// when it holds an HTML document.
+func readWARCResponse(headers textproto.MIMEHeader, block io.Reader) ([]byte, bool, error) {
+	if headers.Get("WARC-Type") != "response" {
+		return nil, false, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(headers.Get("Content-Type"))
+	if mediaType != "application/http" {
+		return nil, false, nil
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(block), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, false, nil
+	}
+
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
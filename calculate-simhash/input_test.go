@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// gzipBytes compresses data as a single gzip member.
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// httpResponse builds a raw HTTP response with the given content type and
+// optional content encoding.
+func httpResponse(contentType, encoding string, body []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 200 OK\r\nContent-Type: %s\r\n", contentType)
+	if encoding != "" {
+		fmt.Fprintf(&buf, "Content-Encoding: %s\r\n", encoding)
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(body))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// warcRecord builds a WARC record holding block.
+func warcRecord(warcType, contentType, targetURI string, block []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "WARC/1.1\r\nWARC-Type: %s\r\nWARC-Target-URI: %s\r\n", warcType, targetURI)
+	fmt.Fprintf(&buf, "Content-Type: %s\r\nContent-Length: %d\r\n\r\n", contentType, len(block))
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+	return buf.Bytes()
+}
+
+// collectDocuments returns the names and contents of the documents emitted by
+// read.
+func collectDocuments(t *testing.T, read func(emit func(document) bool) error) ([]string, []string) {
+	t.Helper()
+	var names, contents []string
+	err := read(func(doc document) bool {
+		names = append(names, doc.Name)
+		contents = append(contents, string(doc.Data))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return names, contents
+}
+
+// testWARC returns a WARC stream mixing HTML responses with records that must
+// be skipped.
+func testWARC(t *testing.T) []byte {
+	t.Helper()
+	const httpType = "application/http; msgtype=response"
+	var warc bytes.Buffer
+	warc.Write(warcRecord("warcinfo", "application/warc-fields", "", []byte("software: test\r\n")))
+	warc.Write(warcRecord("request", "application/http; msgtype=request", "http://example.com/",
+		[]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	warc.Write(warcRecord("response", httpType, "http://example.com/",
+		httpResponse("text/html; charset=utf-8", "", []byte("<p>plain</p>"))))
+	warc.Write(warcRecord("response", httpType, "http://example.com/logo.png",
+		httpResponse("image/png", "", []byte("\x89PNG"))))
+	warc.Write(warcRecord("response", httpType, "http://example.com/gzip",
+		httpResponse("text/html", "gzip", gzipBytes(t, []byte("<p>gzip</p>")))))
+	warc.Write(warcRecord("metadata", "application/warc-fields", "http://example.com/", []byte("outlink: x\r\n")))
+	warc.Write(warcRecord("response", "text/html", "http://example.com/not-http", []byte("<p>raw</p>")))
+	return warc.Bytes()
+}
+
+func TestReadWARCDocuments(t *testing.T) {
+	warc := testWARC(t)
+	names, contents := collectDocuments(t, func(emit func(document) bool) error {
+		return readWARCDocuments(bytes.NewReader(warc), "test.warc", emit)
+	})
+
+	wantNames := []string{"test.warc#000000 http://example.com/", "test.warc#000001 http://example.com/gzip"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("names = %q, want %q", names, wantNames)
+	}
+	wantContents := []string{"<p>plain</p>", "<p>gzip</p>"}
+	if !reflect.DeepEqual(contents, wantContents) {
+		t.Errorf("contents = %q, want %q", contents, wantContents)
+	}
+}
+
+func TestReadWARCDocumentsStopsEarly(t *testing.T) {
+	count := 0
+	err := readWARCDocuments(bytes.NewReader(testWARC(t)), "test.warc", func(document) bool {
+		count++
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("emitted %d documents after emit returned false, want 1", count)
+	}
+}
+
+func TestReadWARCDocumentsRejectsMissingVersion(t *testing.T) {
+	err := readWARCDocuments(bytes.NewReader([]byte("HTTP/1.1 200 OK\r\n\r\n")), "bad.warc", func(document) bool {
+		return true
+	})
+	if err == nil {
+		t.Error("expected error for a stream without a WARC version line")
+	}
+}
+
+func TestReadTarDocuments(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	entries := []struct {
+		header tar.Header
+		data   []byte
+	}{
+		{tar.Header{Name: "pages/", Typeflag: tar.TypeDir, Mode: 0755}, nil},
+		{tar.Header{Name: "pages/a.html", Typeflag: tar.TypeReg, Mode: 0644}, []byte("<p>a</p>")},
+		{tar.Header{Name: "pages/link.html", Typeflag: tar.TypeSymlink, Linkname: "a.html"}, nil},
+		{tar.Header{Name: "pages/b.html.gz", Typeflag: tar.TypeReg, Mode: 0644}, gzipBytes(t, []byte("<p>b</p>"))},
+	}
+	for _, entry := range entries {
+		entry.header.Size = int64(len(entry.data))
+		if err := tw.WriteHeader(&entry.header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, contents := collectDocuments(t, func(emit func(document) bool) error {
+		return readTarDocuments(&archive, "pages.tar", emit)
+	})
+	wantNames := []string{"pages.tar/pages/a.html", "pages.tar/pages/b.html.gz"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("names = %q, want %q", names, wantNames)
+	}
+	wantContents := []string{"<p>a</p>", "<p>b</p>"}
+	if !reflect.DeepEqual(contents, wantContents) {
+		t.Errorf("contents = %q, want %q", contents, wantContents)
+	}
+}
+
+func TestReadDocumentsByExtension(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"page.html":    []byte("<p>plain</p>"),
+		"page.html.gz": gzipBytes(t, []byte("<p>gzip</p>")),
+		"test.warc.gz": gzipBytes(t, testWARC(t)),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file         string
+		wantContents []string
+	}{
+		// Plain files are read later by the worker.
+		{"page.html", []string{""}},
+		{"page.html.gz", []string{"<p>gzip</p>"}},
+		{"test.warc.gz", []string{"<p>plain</p>", "<p>gzip</p>"}},
+	}
+	for _, tt := range tests {
+		_, contents := collectDocuments(t, func(emit func(document) bool) error {
+			return readDocuments(filepath.Join(dir, tt.file), emit)
+		})
+		if !reflect.DeepEqual(contents, tt.wantContents) {
+			t.Errorf("%s: contents = %q, want %q", tt.file, contents, tt.wantContents)
+		}
+	}
+}
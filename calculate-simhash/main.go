@@ -4,12 +4,14 @@ import (
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -23,34 +25,54 @@ type HTMLFeatures map[string]int
 
 // BenchmarkResult represents the timing and results of processing one file.
 type BenchmarkResult struct {
-	FileReadTime           float64
-	FeatureExtractionTime  float64
-	SimHashCalculationTime float64
-	SimHashEncodingTime    float64
-	TotalProcessingTime    float64
-	FeatureCount           int
-	SimHash                string
-	Error                  string
+	File                   string  `json:"file"`
+	FileReadTime           float64 `json:"file_read_time"`
+	FeatureExtractionTime  float64 `json:"feature_extraction_time"`
+	SimHashCalculationTime float64 `json:"simhash_calculation_time"`
+	SimHashEncodingTime    float64 `json:"simhash_encoding_time"`
+	TotalProcessingTime    float64 `json:"total_processing_time"`
+	FeatureCount           int     `json:"feature_count"`
+	FileSize               int     `json:"file_size"`
+	SimHash                string  `json:"simhash"`
+	Error                  string  `json:"error,omitempty"`
+	// Memory is only recorded when memory tracking is enabled.
+	Memory *MemoryStats `json:"memory,omitempty"`
+	// memoryOverhead is the time spent collecting Memory. It is excluded
+	// from TotalProcessingTime.
+	memoryOverhead time.Duration
 }
 
-// BenchmarkSummary contains overall benchmark metrics.
-type BenchmarkSummary struct {
-	TotalBenchmarkTime        float64
-	FilesProcessed            int
-	AverageFileProcessingTime float64
+// BenchmarkConfig represents the benchmark configuration.
+type BenchmarkConfig struct {
+	FolderPath       string
+	SimHashSize      int
+	MaxFiles         int
+	Workers          int
+	WarmupIterations int
+	Iterations       int
+	TrackMemory      bool
 }
 
-// TimeCapture represents a timestamp and its corresponding SimHash.
-type TimeCapture struct {
-	Timestamp string
-	SimHash   string
+// BenchmarkSummary contains overall benchmark metrics.
+type BenchmarkSummary struct {
+	TotalBenchmarkTime        float64 `json:"total_benchmark_time"`
+	FilesProcessed            int     `json:"files_processed"`
+	AverageFileProcessingTime float64 `json:"average_file_processing_time"`
+	Workers                   int     `json:"workers"`
+	BytesProcessed            int64   `json:"bytes_processed"`
+	DocsPerSecond             float64 `json:"docs_per_second"`
+	MBPerSecond               float64 `json:"mb_per_second"`
+	// WorkerUtilization is the fraction of the benchmark wall time each
+	// worker spent processing files.
+	WorkerUtilization []float64 `json:"worker_utilization"`
+	WarmupIterations  int       `json:"warmup_iterations"`
+	Iterations        int       `json:"iterations"`
+	// Stages holds per-stage statistics across all measured iterations.
+	Stages *StageSummary `json:"stages,omitempty"`
 }
 
-// CompressedCaptures is the compressed representation of the captures.
-type CompressedCaptures struct {
-	Captures []interface{}
-	Hashes   []string
-}
+// demoCaptureTime is the timestamp of the first capture in the compression demo.
+var demoCaptureTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
 
 // simpleFeatureSet is a simple type that implements simhash.FeatureSet.
 // It wraps a slice of simhash.Feature.
@@ -173,81 +195,169 @@ func packSimHashToBytes(simHash uint64) []byte {
 	return bytes
 }
 
-// processHTMLFile processes a single HTML file and returns timing metrics and SimHash.
-func processHTMLFile(filePath string, simHashSize int) BenchmarkResult {
-	result := BenchmarkResult{}
+// processHTMLDocument processes a single HTML document and returns timing
+// metrics and SimHash. Documents already read from an archive keep the read
+// time measured while scanning it.
+func processHTMLDocument(doc document, config BenchmarkConfig) BenchmarkResult {
+	result := BenchmarkResult{File: doc.Name}
+	var memory MemoryStats
+	probe := newMemoryProbe(config.TrackMemory)
+	defer probe.close()
 
 	// Step 1: Read the file.
-	startTime := time.Now()
-	htmlBytes, err := os.ReadFile(filePath)
-	if err != nil {
-		result.Error = fmt.Sprintf("Failed to read file %s: %v", filePath, err)
-		return result
+	htmlBytes := doc.Data
+	if htmlBytes == nil {
+		probe.start()
+		startTime := time.Now()
+		var err error
+		htmlBytes, err = os.ReadFile(doc.Path)
+		if err != nil {
+			result.Error = fmt.Sprintf("Failed to read file %s: %v", doc.Path, err)
+			return result
+		}
+		result.FileReadTime = time.Since(startTime).Seconds()
+		memory.FileRead = &StageMemory{}
+		probe.stop(memory.FileRead)
+	} else {
+		result.FileReadTime = doc.ReadTime
 	}
 	htmlContent := string(htmlBytes)
-	result.FileReadTime = time.Since(startTime).Seconds()
+	result.FileSize = len(htmlBytes)
 
 	// Step 2: Extract features.
-	startTime = time.Now()
+	probe.start()
+	startTime := time.Now()
 	features, err := extractHTMLFeatures(htmlContent)
 	if err != nil {
-		result.Error = fmt.Sprintf("Failed to extract features from %s: %v", filePath, err)
+		result.Error = fmt.Sprintf("Failed to extract features from %s: %v", doc.Name, err)
 		return result
 	}
 	result.FeatureExtractionTime = time.Since(startTime).Seconds()
+	probe.stop(&memory.FeatureExtraction)
 	result.FeatureCount = len(features)
 
 	// Step 3: Calculate SimHash.
+	probe.start()
 	startTime = time.Now()
-	simHashValue := calculateSimHash(features, simHashSize)
+	simHashValue := calculateSimHash(features, config.SimHashSize)
 	result.SimHashCalculationTime = time.Since(startTime).Seconds()
+	probe.stop(&memory.SimHashCalculation)
 
 	// Step 4: Pack SimHash to bytes and encode.
+	probe.start()
 	startTime = time.Now()
 	simHashBytes := packSimHashToBytes(simHashValue)
 	result.SimHash = base64.StdEncoding.EncodeToString(simHashBytes)
 	result.SimHashEncodingTime = time.Since(startTime).Seconds()
+	probe.stop(&memory.SimHashEncoding)
+
+	if config.TrackMemory {
+		result.Memory = &memory
+	}
+	result.memoryOverhead = probe.elapsed()
 
 	result.TotalProcessingTime = result.FileReadTime + result.FeatureExtractionTime + result.SimHashCalculationTime + result.SimHashEncodingTime
 
 	return result
 }
 
-// benchmarkHTMLProcessing benchmarks HTML processing for all files in a folder.
-func benchmarkHTMLProcessing(folderPath string, simHashSize int) (map[string]BenchmarkResult, BenchmarkSummary) {
-	results := make(map[string]BenchmarkResult)
+// benchmarkHTMLProcessing benchmarks HTML processing for documents in a folder
+// using a pool of workers. With a single worker documents are processed
+// sequentially. Plain files, gzip files, tar archives and WARC files are read;
+// see readDocuments. A MaxFiles value of zero or less processes every
+// document. Results are sorted by name so repeated runs report in the same
+// order.
+func benchmarkHTMLProcessing(config BenchmarkConfig) ([]BenchmarkResult, BenchmarkSummary, error) {
+	var results []BenchmarkResult
 	summary := BenchmarkSummary{}
 
+	folderPath := config.FolderPath
+	workers := config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	summary.Workers = workers
+
 	totalStartTime := time.Now()
 
 	// Get list of files in the folder.
-	files, err := os.ReadDir(folderPath)
+	paths, err := listInputFiles(folderPath)
 	if err != nil {
-		results["error"] = BenchmarkResult{
-			Error: fmt.Sprintf("Failed to list directory %s: %v", folderPath, err),
-		}
-		return results, summary
+		return nil, summary, err
 	}
 
-	// Process each file (up to 5).
-	fileCount := 0
-	totalProcessingTime := 0.0
+	jobs := make(chan document, workers)
+	resultsChan := make(chan BenchmarkResult, workers)
+	busyTimes := make([]float64, workers)
+
+	var wg sync.WaitGroup
+
+	// Launch worker goroutines. Each worker only writes its own busy time slot.
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for doc := range jobs {
+				startTime := time.Now()
+				fileResult := processHTMLDocument(doc, config)
+				// Time spent reading memory statistics is not processing time.
+				elapsed := (time.Since(startTime) - fileResult.memoryOverhead).Seconds()
+				busyTimes[worker] += elapsed
+				if doc.Data != nil {
+					elapsed += doc.ReadTime
+				}
+				fileResult.TotalProcessingTime = elapsed
+				resultsChan <- fileResult
+			}
+		}(w)
+	}
 
-	for _, file := range files {
-		if file.IsDir() || fileCount >= 5 {
-			continue
+	// Scan the inputs, expanding archives into their documents. A file that
+	// cannot be read is reported as a failed result.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+
+		count := 0
+		for _, path := range paths {
+			if config.MaxFiles > 0 && count >= config.MaxFiles {
+				return
+			}
+			err := readDocuments(path, func(doc document) bool {
+				if config.MaxFiles > 0 && count >= config.MaxFiles {
+					return false
+				}
+				jobs <- doc
+				count++
+				return true
+			})
+			if err != nil {
+				resultsChan <- BenchmarkResult{File: filepath.Base(path), Error: err.Error()}
+			}
 		}
+	}()
 
-		filePath := filepath.Join(folderPath, file.Name())
-		startTime := time.Now()
-		fileResult := processHTMLFile(filePath, simHashSize)
-		fileResult.TotalProcessingTime = time.Since(startTime).Seconds()
+	go func() {
+		wg.Wait()
+		close(resultsChan)
+	}()
+
+	fileCount := 0
+	totalProcessingTime := 0.0
 
-		results[file.Name()] = fileResult
-		totalProcessingTime += fileResult.TotalProcessingTime
+	for result := range resultsChan {
+		results = append(results, result)
+		totalProcessingTime += result.TotalProcessingTime
+		summary.BytesProcessed += int64(result.FileSize)
 		fileCount++
 	}
 
+	// Workers finish in arbitrary order.
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].File < results[j].File
+	})
+
 	// Calculate overall metrics.
 	summary.TotalBenchmarkTime = time.Since(totalStartTime).Seconds()
 	summary.FilesProcessed = fileCount
@@ -256,133 +366,100 @@ func benchmarkHTMLProcessing(folderPath string, simHashSize int) (map[string]Ben
 		summary.AverageFileProcessingTime = totalProcessingTime / float64(fileCount)
 	}
 
-	return results, summary
-}
-
-// compressCaptures compresses timestamp and SimHash pairs.
-func compressCaptures(captures []TimeCapture) CompressedCaptures {
-	hashDict := make(map[string]int)
-	grouped := make(map[int]map[int]map[int][]interface{})
-
-	for _, capture := range captures {
-		ts := capture.Timestamp
-		simHash := capture.SimHash
-
-		// Parse timestamp components.
-		year, _ := strToInt(ts[0:4])
-		month, _ := strToInt(ts[4:6])
-		day, _ := strToInt(ts[6:8])
-		hms := ts[8:]
-
-		// Get or assign hash ID.
-		hashID, exists := hashDict[simHash]
-		if !exists {
-			hashID = len(hashDict)
-			hashDict[simHash] = hashID
-		}
+	if summary.TotalBenchmarkTime > 0 {
+		summary.DocsPerSecond = float64(fileCount) / summary.TotalBenchmarkTime
+		summary.MBPerSecond = float64(summary.BytesProcessed) / 1e6 / summary.TotalBenchmarkTime
 
-		// Create nested maps if they don't exist.
-		if _, exists := grouped[year]; !exists {
-			grouped[year] = make(map[int]map[int][]interface{})
+		summary.WorkerUtilization = make([]float64, workers)
+		for i, busy := range busyTimes {
+			summary.WorkerUtilization[i] = busy / summary.TotalBenchmarkTime
 		}
-		if _, exists := grouped[year][month]; !exists {
-			grouped[year][month] = make(map[int][]interface{})
-		}
-		if _, exists := grouped[year][month][day]; !exists {
-			grouped[year][month][day] = make([]interface{}, 0)
-		}
-
-		// Add capture.
-		cap := []interface{}{hms, hashID}
-		grouped[year][month][day] = append(grouped[year][month][day], cap)
-	}
-
-	// Build compressed captures.
-	compressedCaptures := CompressedCaptures{}
-
-	// Sort years.
-	var years []int
-	for year := range grouped {
-		years = append(years, year)
 	}
-	sort.Ints(years)
 
-	// Build the nested structure.
-	for _, year := range years {
-		yearData := []interface{}{year}
+	return results, summary, nil
+}
 
-		// Sort months.
-		var months []int
-		for month := range grouped[year] {
-			months = append(months, month)
+func main() {
+	folderPath := flag.String("dir", "pages/", "Folder containing HTML, .gz, .tar(.gz) or .warc(.gz) files to benchmark")
+	maxFiles := flag.Int("max-files", 5, "Maximum number of documents to process (0 for all)")
+	workers := flag.Int("workers", 1, "Number of concurrent workers processing files")
+	warmup := flag.Int("warmup", 0, "Number of warmup iterations excluded from statistics")
+	iterations := flag.Int("iterations", 1, "Number of measured iterations")
+	hammingThreshold := flag.Int("hamming-threshold", 0, "Share hash IDs between SimHashes within this many bits in the compression demo")
+	trackMemory := flag.Bool("memstats", false, "Record per-stage allocations and peak heap, sampled every millisecond (most accurate with -workers 1; the stop-the-world reads are excluded from per-file times but not from total_benchmark_time or throughput)")
+	formats := flag.String("format", "", "Comma-separated machine-readable outputs to write (json, csv)")
+	outDir := flag.String("out-dir", "benchmarks-go", "Directory for machine-readable benchmark output and profiles")
+	profiling := registerProfileFlags()
+
+	generateDir := flag.String("generate", "", "Write a synthetic corpus to this folder instead of running the benchmark")
+	seed := flag.Int64("seed", 1, "Random seed for the synthetic corpus")
+	genDocs := flag.Int("gen-docs", 100, "Number of pages in the synthetic corpus")
+	genWords := flag.Int("gen-words", 1000, "Number of words per synthetic page")
+	genVocab := flag.Int("gen-vocab", 5000, "Vocabulary size of the synthetic corpus")
+	genMutation := flag.Float64("gen-mutation", 0.05, "Fraction of words replaced between consecutive page versions")
+	genVersions := flag.Int("gen-versions", 3, "Number of versions per synthetic page, including the original")
+
+	flag.Parse()
+
+	if *generateDir != "" {
+		corpus := CorpusConfig{
+			OutputDir:    *generateDir,
+			Seed:         *seed,
+			Documents:    *genDocs,
+			Words:        *genWords,
+			Vocabulary:   *genVocab,
+			MutationRate: *genMutation,
+			Versions:     *genVersions,
 		}
-		sort.Ints(months)
-
-		for _, month := range months {
-			monthData := []interface{}{month}
-
-			// Sort days.
-			var days []int
-			for day := range grouped[year][month] {
-				days = append(days, day)
-			}
-			sort.Ints(days)
-
-			for _, day := range days {
-				dayData := []interface{}{day}
-				dayData = append(dayData, grouped[year][month][day]...)
-				monthData = append(monthData, dayData)
-			}
-
-			yearData = append(yearData, monthData)
+		validation, err := generateCorpus(corpus)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
 
-		compressedCaptures.Captures = append(compressedCaptures.Captures, yearData)
+		fmt.Printf("Generated %d pages with %d versions each in %s\n", corpus.Documents, corpus.Versions, corpus.OutputDir)
+		fmt.Println("\n=== Hamming Distance Validation ===")
+		fmt.Printf("%-8s %14s %14s %16s\n", "Version", "Injected edits", "Measured edits", "Mean Hamming")
+		for _, v := range validation.Versions {
+			fmt.Printf("%-8d %13.2f%% %13.2f%% %16.2f\n", v.Version, v.InjectedEditRate*100, v.MeasuredEditRate*100, v.MeanHammingDistance)
+		}
+		fmt.Printf("Edit rate / Hamming distance correlation: %.3f\n", validation.Correlation)
+		return
 	}
 
-	// Sort hashes by hash ID.
-	type hashPair struct {
-		hash   string
-		hashID int
-	}
-	var pairs []hashPair
-	for hash, id := range hashDict {
-		pairs = append(pairs, hashPair{hash, id})
+	config := BenchmarkConfig{
+		FolderPath:       *folderPath,
+		SimHashSize:      64,
+		MaxFiles:         *maxFiles,
+		Workers:          *workers,
+		WarmupIterations: *warmup,
+		Iterations:       *iterations,
+		TrackMemory:      *trackMemory,
 	}
 
-	sort.Slice(pairs, func(i, j int) bool {
-		return pairs[i].hashID < pairs[j].hashID
-	})
-
-	for _, pair := range pairs {
-		compressedCaptures.Hashes = append(compressedCaptures.Hashes, pair.hash)
-	}
-
-	return compressedCaptures
-}
-
-// strToInt converts string to int safely.
-func strToInt(s string) (int, error) {
-	var result int
-	for _, c := range s {
-		if c < '0' || c > '9' {
-			return 0, fmt.Errorf("invalid digit: %c", c)
-		}
-		result = result*10 + int(c-'0')
+	stopProfiling, err := startProfiling(profiling, *outDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	return result, nil
+	// Exit only after the profilers have stopped so failed runs still leave
+	// complete profiles behind.
+	code := run(config, *formats, *outDir, *hammingThreshold)
+	stopProfiling()
+	os.Exit(code)
 }
 
-func main() {
+// run runs the benchmark, prints and writes its results and the compression
+// demo, and returns the process exit code.
+func run(config BenchmarkConfig, formats, outDir string, hammingThreshold int) int {
 	fmt.Println("Starting HTML SimHash benchmark...")
 
-	// Run the benchmark.
-	results, summary := benchmarkHTMLProcessing("pages/", 64)
+	results, summary, err := runBenchmarkIterations(config)
 
 	// Check for errors.
-	if result, hasError := results["error"]; hasError {
-		fmt.Printf("Error: %s\n", result.Error)
-		return
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
 	}
 
 	// Print results.
@@ -390,10 +467,25 @@ func main() {
 	fmt.Printf("Total files processed: %d\n", summary.FilesProcessed)
 	fmt.Printf("Total benchmark time: %.4f seconds\n", summary.TotalBenchmarkTime)
 	fmt.Printf("Average file processing time: %.4f seconds\n", summary.AverageFileProcessingTime)
+	fmt.Printf("Workers: %d\n", summary.Workers)
+	fmt.Printf("Throughput: %.2f docs/s, %.2f MB/s\n", summary.DocsPerSecond, summary.MBPerSecond)
+	for i, utilization := range summary.WorkerUtilization {
+		fmt.Printf("Worker %d utilization: %.1f%%\n", i, utilization*100)
+	}
+
+	if summary.Iterations > 1 && summary.Stages != nil {
+		fmt.Printf("\nStage statistics over %d iterations (%d warmup, seconds):\n", summary.Iterations, summary.WarmupIterations)
+		fmt.Printf("%-26s %10s %10s %10s %10s %10s %10s\n", "Stage", "Mean", "Median", "P95", "Min", "Max", "StdDev")
+		for _, stage := range summary.Stages.namedStages() {
+			st := stage.Stats
+			fmt.Printf("%-26s %10.6f %10.6f %10.6f %10.6f %10.6f %10.6f\n",
+				stage.Name, st.Mean, st.Median, st.P95, st.Min, st.Max, st.StdDev)
+		}
+	}
 
 	fmt.Println("\nDetailed per-file results:")
-	for fileName, result := range results {
-		fmt.Printf("\n--- %s ---\n", fileName)
+	for _, result := range results {
+		fmt.Printf("\n--- %s ---\n", result.File)
 		if result.Error != "" {
 			fmt.Printf("Error: %s\n", result.Error)
 			continue
@@ -405,17 +497,41 @@ func main() {
 		fmt.Printf("Total processing time: %.4f seconds\n", result.TotalProcessingTime)
 		fmt.Printf("Feature count: %d\n", result.FeatureCount)
 		fmt.Printf("SimHash: %s\n", result.SimHash)
+		if m := result.Memory; m != nil {
+			if m.FileRead != nil {
+				fmt.Printf("File read memory: %d bytes, %d allocs, %d peak heap\n",
+					m.FileRead.BytesAllocated, m.FileRead.Allocations, m.FileRead.PeakHeap)
+			} else {
+				fmt.Println("File read memory: not measured (read while scanning the archive)")
+			}
+			fmt.Printf("Feature extraction memory: %d bytes, %d allocs, %d peak heap\n",
+				m.FeatureExtraction.BytesAllocated, m.FeatureExtraction.Allocations, m.FeatureExtraction.PeakHeap)
+			fmt.Printf("SimHash calculation memory: %d bytes, %d allocs, %d peak heap\n",
+				m.SimHashCalculation.BytesAllocated, m.SimHashCalculation.Allocations, m.SimHashCalculation.PeakHeap)
+			fmt.Printf("SimHash encoding memory: %d bytes, %d allocs, %d peak heap\n",
+				m.SimHashEncoding.BytesAllocated, m.SimHashEncoding.Allocations, m.SimHashEncoding.PeakHeap)
+		}
 	}
 
-	// Create timestamp and simhash pairs for compression demo.
+	if formats != "" {
+		files, err := writeBenchmarkOutputs(outDir, strings.Split(formats, ","), results, summary)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		for _, file := range files {
+			fmt.Printf("\nResults saved to: %s\n", file)
+		}
+	}
+
+	// Create timestamp and simhash pairs for compression demo. Each file is
+	// treated as a daily capture starting at a fixed date so the compressed
+	// output is the same on every run.
 	var captures []TimeCapture
-	for _, result := range results {
+	for i, result := range results {
 		if result.Error == "" {
-			now := time.Now()
-			timestamp := fmt.Sprintf("%04d%02d%02d%02d%02d%02d",
-				now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second())
 			captures = append(captures, TimeCapture{
-				Timestamp: timestamp,
+				Timestamp: demoCaptureTime.AddDate(0, 0, i).Format(waybackTimestampLayout),
 				SimHash:   result.SimHash,
 			})
 		}
@@ -423,12 +539,17 @@ func main() {
 
 	if len(captures) > 0 {
 		fmt.Println("\n=== Compressed Captures Demo ===")
-		compressedCaptures := compressCaptures(captures)
+		compressedCaptures, rejected := compressCapturesWithOptions(captures, CompressOptions{HammingThreshold: hammingThreshold})
 		fmt.Printf("Original captures count: %d\n", len(captures))
+		for _, r := range rejected {
+			fmt.Printf("Rejected capture: %v\n", r.Err)
+		}
 		fmt.Printf("Unique hashes count: %d\n", len(compressedCaptures.Hashes))
 		if len(compressedCaptures.Hashes) > 0 {
 			count := int(math.Min(3, float64(len(compressedCaptures.Hashes))))
 			fmt.Printf("First few hashes: %v\n", compressedCaptures.Hashes[:count])
 		}
 	}
+
+	return 0
 }
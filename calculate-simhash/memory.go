@@ -0,0 +1,129 @@
+package main
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// heapSampleInterval is how often a running probe samples the heap size.
+const heapSampleInterval = time.Millisecond
+
+// heapObjectsMetric is the runtime/metrics equivalent of MemStats.HeapAlloc.
+// Reading it does not stop the world.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// StageMemory records heap activity during one processing stage.
+type StageMemory struct {
+	BytesAllocated uint64 `json:"bytes_allocated"`
+	Allocations    uint64 `json:"allocations"`
+	// PeakHeap is the largest heap size seen during the stage: at its start
+	// and end, and every heapSampleInterval while it runs. Spikes shorter
+	// than the interval can be missed.
+	PeakHeap uint64 `json:"peak_heap"`
+}
+
+// MemoryStats records heap activity for each stage of processing one file.
+// The runtime counters are process-wide, so with more than one worker the
+// deltas include allocations made by other workers. FileRead is nil for
+// documents from gzip, tar and WARC files, which are read while scanning the
+// archive rather than by the worker, so their read is not measured.
+type MemoryStats struct {
+	FileRead           *StageMemory `json:"file_read,omitempty"`
+	FeatureExtraction  StageMemory  `json:"feature_extraction"`
+	SimHashCalculation StageMemory  `json:"simhash_calculation"`
+	SimHashEncoding    StageMemory  `json:"simhash_encoding"`
+}
+
+// memoryProbe measures heap activity between start and stop. A nil probe
+// does nothing, so callers need not check whether tracking is enabled.
+type memoryProbe struct {
+	before runtime.MemStats
+	// overhead is the time spent in runtime.ReadMemStats, which stops the
+	// world, and in starting and stopping the sampler. It falls outside the
+	// stage timers but inside the caller's.
+	overhead time.Duration
+	// done stops the heap sampler, which then sends its peak on peak.
+	done chan struct{}
+	peak chan uint64
+}
+
+// newMemoryProbe returns a probe, or nil when tracking is disabled.
+func newMemoryProbe(enabled bool) *memoryProbe {
+	if !enabled {
+		return nil
+	}
+	return &memoryProbe{}
+}
+
+// start snapshots the runtime memory counters.
+func (p *memoryProbe) start() {
+	if p == nil {
+		return
+	}
+	startTime := time.Now()
+	runtime.ReadMemStats(&p.before)
+	p.done = make(chan struct{})
+	p.peak = make(chan uint64, 1)
+	go sampleHeapPeak(p.done, p.peak)
+	p.overhead += time.Since(startTime)
+}
+
+// sampleHeapPeak samples the heap size every heapSampleInterval until done is
+// closed, then sends the largest size seen on peak.
+func sampleHeapPeak(done <-chan struct{}, peak chan<- uint64) {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	ticker := time.NewTicker(heapSampleInterval)
+	defer ticker.Stop()
+
+	var highest uint64
+	for {
+		select {
+		case <-done:
+			peak <- highest
+			return
+		case <-ticker.C:
+			metrics.Read(sample)
+			if sample[0].Value.Kind() == metrics.KindUint64 {
+				highest = max(highest, sample[0].Value.Uint64())
+			}
+		}
+	}
+}
+
+// stop records the heap activity since the last call to start into stage.
+func (p *memoryProbe) stop(stage *StageMemory) {
+	if p == nil {
+		return
+	}
+	var after runtime.MemStats
+	startTime := time.Now()
+	close(p.done)
+	sampled := <-p.peak
+	p.done = nil
+	runtime.ReadMemStats(&after)
+	p.overhead += time.Since(startTime)
+
+	stage.BytesAllocated = after.TotalAlloc - p.before.TotalAlloc
+	stage.Allocations = after.Mallocs - p.before.Mallocs
+	stage.PeakHeap = max(p.before.HeapAlloc, sampled, after.HeapAlloc)
+}
+
+// close stops the heap sampler of a stage that was started but not stopped,
+// as when processing fails mid-stage.
+func (p *memoryProbe) close() {
+	if p == nil || p.done == nil {
+		return
+	}
+	close(p.done)
+	<-p.peak
+	p.done = nil
+}
+
+// elapsed returns the time spent reading memory statistics so far.
+func (p *memoryProbe) elapsed() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.overhead
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMemoryProbePeakHeapSeesFreedGrowth(t *testing.T) {
+	const size = 64 << 20
+
+	runtime.GC()
+	var stage StageMemory
+	probe := newMemoryProbe(true)
+	probe.start()
+
+	// Hold a large buffer across several sample intervals, then free it so
+	// the heap at the end of the stage is back near its starting size.
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	time.Sleep(20 * heapSampleInterval)
+	runtime.KeepAlive(buf)
+	buf = nil
+	runtime.GC()
+
+	probe.stop(&stage)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	if after.HeapAlloc >= size {
+		t.Skipf("buffer not collected (heap %d bytes)", after.HeapAlloc)
+	}
+	if stage.PeakHeap < size {
+		t.Errorf("peak heap = %d bytes, want at least the %d byte buffer", stage.PeakHeap, size)
+	}
+	if stage.BytesAllocated < size {
+		t.Errorf("bytes allocated = %d, want at least %d", stage.BytesAllocated, size)
+	}
+}
+
+func TestMemoryProbeCloseStopsSampler(t *testing.T) {
+	before := runtime.NumGoroutine()
+	probe := newMemoryProbe(true)
+	probe.start()
+	probe.close()
+	probe.close()
+
+	// The sampler exits just after sending its peak, so allow it a moment.
+	after := runtime.NumGoroutine()
+	for deadline := time.Now().Add(time.Second); after > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		after = runtime.NumGoroutine()
+	}
+	if after > before {
+		t.Errorf("%d goroutines after close, want at most %d", after, before)
+	}
+}
+
+func TestNilMemoryProbe(t *testing.T) {
+	var stage StageMemory
+	probe := newMemoryProbe(false)
+	probe.start()
+	probe.stop(&stage)
+	if stage != (StageMemory{}) || probe.elapsed() != 0 {
+		t.Errorf("disabled probe recorded %+v in %s", stage, probe.elapsed())
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// benchmarkReport is the machine-readable form of a benchmark run. Field names
+// follow the result dicts of the Python implementation.
+type benchmarkReport struct {
+	Summary BenchmarkSummary  `json:"summary"`
+	Results []BenchmarkResult `json:"results"`
+}
+
+// resultCSVHeader lists the per-file CSV columns in output order.
+var resultCSVHeader = []string{
+	"file",
+	"file_read_time",
+	"feature_extraction_time",
+	"simhash_calculation_time",
+	"simhash_encoding_time",
+	"total_processing_time",
+	"feature_count",
+	"file_size",
+	"simhash",
+	"error",
+	"file_read_bytes_allocated",
+	"file_read_allocations",
+	"file_read_peak_heap",
+	"feature_extraction_bytes_allocated",
+	"feature_extraction_allocations",
+	"feature_extraction_peak_heap",
+	"simhash_calculation_bytes_allocated",
+	"simhash_calculation_allocations",
+	"simhash_calculation_peak_heap",
+	"simhash_encoding_bytes_allocated",
+	"simhash_encoding_allocations",
+	"simhash_encoding_peak_heap",
+}
+
+// summaryCSVHeader lists the summary CSV columns in output order.
+var summaryCSVHeader = []string{
+	"total_benchmark_time",
+	"files_processed",
+	"average_file_processing_time",
+	"workers",
+	"bytes_processed",
+	"docs_per_second",
+	"mb_per_second",
+	"worker_utilization",
+	"warmup_iterations",
+	"iterations",
+}
+
+// stageCSVHeader lists the stage statistics CSV columns in output order.
+var stageCSVHeader = []string{
+	"stage",
+	"samples",
+	"mean",
+	"median",
+	"p95",
+	"min",
+	"max",
+	"stddev",
+}
+
+// writeBenchmarkOutputs writes the results in each requested format to outDir
+// and returns the paths of the files written.
+func writeBenchmarkOutputs(outDir string, formats []string, results []BenchmarkResult, summary BenchmarkSummary) ([]string, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory %s: %v", outDir, err)
+	}
+
+	var written []string
+	for _, format := range formats {
+		switch strings.ToLower(strings.TrimSpace(format)) {
+		case "json":
+			path := filepath.Join(outDir, "simhash_results.json")
+			if err := writeJSONReport(path, results, summary); err != nil {
+				return written, err
+			}
+			written = append(written, path)
+		case "csv":
+			resultsPath := filepath.Join(outDir, "simhash_results.csv")
+			if err := writeResultsCSV(resultsPath, results); err != nil {
+				return written, err
+			}
+			summaryPath := filepath.Join(outDir, "simhash_summary.csv")
+			if err := writeSummaryCSV(summaryPath, summary); err != nil {
+				return written, err
+			}
+			written = append(written, resultsPath, summaryPath)
+			if summary.Stages != nil {
+				stagesPath := filepath.Join(outDir, "simhash_stages.csv")
+				if err := writeStagesCSV(stagesPath, summary.Stages); err != nil {
+					return written, err
+				}
+				written = append(written, stagesPath)
+			}
+		case "":
+		default:
+			return written, fmt.Errorf("unknown output format %q", format)
+		}
+	}
+
+	return written, nil
+}
+
+// writeJSONReport writes the summary and per-file results as indented JSON.
+func writeJSONReport(path string, results []BenchmarkResult, summary BenchmarkSummary) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(benchmarkReport{Summary: summary, Results: results}); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeResultsCSV writes one row per processed file.
+func writeResultsCSV(path string, results []BenchmarkResult) error {
+	rows := [][]string{resultCSVHeader}
+	for _, result := range results {
+		row := []string{
+			result.File,
+			formatFloat(result.FileReadTime),
+			formatFloat(result.FeatureExtractionTime),
+			formatFloat(result.SimHashCalculationTime),
+			formatFloat(result.SimHashEncodingTime),
+			formatFloat(result.TotalProcessingTime),
+			strconv.Itoa(result.FeatureCount),
+			strconv.Itoa(result.FileSize),
+			result.SimHash,
+			result.Error,
+		}
+		if m := result.Memory; m != nil {
+			for _, stage := range []*StageMemory{m.FileRead, &m.FeatureExtraction, &m.SimHashCalculation, &m.SimHashEncoding} {
+				if stage == nil {
+					// Not measured for documents read from an archive.
+					row = append(row, "", "", "")
+					continue
+				}
+				row = append(row,
+					strconv.FormatUint(stage.BytesAllocated, 10),
+					strconv.FormatUint(stage.Allocations, 10),
+					strconv.FormatUint(stage.PeakHeap, 10),
+				)
+			}
+		} else {
+			row = append(row, make([]string, len(resultCSVHeader)-len(row))...)
+		}
+		rows = append(rows, row)
+	}
+
+	return writeCSV(path, rows)
+}
+
+// writeSummaryCSV writes the summary as a single CSV row. Worker utilization
+// values are joined with semicolons.
+func writeSummaryCSV(path string, summary BenchmarkSummary) error {
+	utilization := make([]string, len(summary.WorkerUtilization))
+	for i, u := range summary.WorkerUtilization {
+		utilization[i] = formatFloat(u)
+	}
+
+	rows := [][]string{
+		summaryCSVHeader,
+		{
+			formatFloat(summary.TotalBenchmarkTime),
+			strconv.Itoa(summary.FilesProcessed),
+			formatFloat(summary.AverageFileProcessingTime),
+			strconv.Itoa(summary.Workers),
+			strconv.FormatInt(summary.BytesProcessed, 10),
+			formatFloat(summary.DocsPerSecond),
+			formatFloat(summary.MBPerSecond),
+			strings.Join(utilization, ";"),
+			strconv.Itoa(summary.WarmupIterations),
+			strconv.Itoa(summary.Iterations),
+		},
+	}
+
+	return writeCSV(path, rows)
+}
+
+// writeStagesCSV writes one row of statistics per processing stage.
+func writeStagesCSV(path string, stages *StageSummary) error {
+	rows := [][]string{stageCSVHeader}
+	for _, stage := range stages.namedStages() {
+		st := stage.Stats
+		rows = append(rows, []string{
+			stage.Name,
+			strconv.Itoa(st.Samples),
+			formatFloat(st.Mean),
+			formatFloat(st.Median),
+			formatFloat(st.P95),
+			formatFloat(st.Min),
+			formatFloat(st.Max),
+			formatFloat(st.StdDev),
+		})
+	}
+
+	return writeCSV(path, rows)
+}
+
+// writeCSV writes rows to a new CSV file at path.
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// formatFloat formats a float with the minimal precision needed to round-trip.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
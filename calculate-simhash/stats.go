@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// StageStats summarizes the timings recorded for one processing stage.
+type StageStats struct {
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	Median  float64 `json:"median"`
+	P95     float64 `json:"p95"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	StdDev  float64 `json:"stddev"`
+}
+
+// StageSummary holds the timing statistics of every stage across all
+// measured iterations. Per-file stages have one sample per file and
+// iteration; TotalBenchmarkTime has one sample per iteration.
+type StageSummary struct {
+	FileRead           StageStats `json:"file_read_time"`
+	FeatureExtraction  StageStats `json:"feature_extraction_time"`
+	SimHashCalculation StageStats `json:"simhash_calculation_time"`
+	SimHashEncoding    StageStats `json:"simhash_encoding_time"`
+	TotalProcessing    StageStats `json:"total_processing_time"`
+	TotalBenchmark     StageStats `json:"total_benchmark_time"`
+}
+
+// namedStage pairs stage statistics with the stage's result field name.
+type namedStage struct {
+	Name  string
+	Stats StageStats
+}
+
+// namedStages returns the stages in processing order.
+func (s *StageSummary) namedStages() []namedStage {
+	return []namedStage{
+		{"file_read_time", s.FileRead},
+		{"feature_extraction_time", s.FeatureExtraction},
+		{"simhash_calculation_time", s.SimHashCalculation},
+		{"simhash_encoding_time", s.SimHashEncoding},
+		{"total_processing_time", s.TotalProcessing},
+		{"total_benchmark_time", s.TotalBenchmark},
+	}
+}
+
+// stageSamples collects raw timings per stage across iterations.
+type stageSamples struct {
+	fileRead           []float64
+	featureExtraction  []float64
+	simHashCalculation []float64
+	simHashEncoding    []float64
+	totalProcessing    []float64
+	totalBenchmark     []float64
+}
+
+// add records the timings of one iteration. Failed files are skipped.
+func (s *stageSamples) add(results []BenchmarkResult, summary BenchmarkSummary) {
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		s.fileRead = append(s.fileRead, result.FileReadTime)
+		s.featureExtraction = append(s.featureExtraction, result.FeatureExtractionTime)
+		s.simHashCalculation = append(s.simHashCalculation, result.SimHashCalculationTime)
+		s.simHashEncoding = append(s.simHashEncoding, result.SimHashEncodingTime)
+		s.totalProcessing = append(s.totalProcessing, result.TotalProcessingTime)
+	}
+	s.totalBenchmark = append(s.totalBenchmark, summary.TotalBenchmarkTime)
+}
+
+// summarize computes statistics for every stage.
+func (s *stageSamples) summarize() *StageSummary {
+	return &StageSummary{
+		FileRead:           computeStageStats(s.fileRead),
+		FeatureExtraction:  computeStageStats(s.featureExtraction),
+		SimHashCalculation: computeStageStats(s.simHashCalculation),
+		SimHashEncoding:    computeStageStats(s.simHashEncoding),
+		TotalProcessing:    computeStageStats(s.totalProcessing),
+		TotalBenchmark:     computeStageStats(s.totalBenchmark),
+	}
+}
+
+// computeStageStats calculates descriptive statistics for samples. The p95 is
+// the nearest-rank percentile and the standard deviation is the sample
+// standard deviation.
+func computeStageStats(samples []float64) StageStats {
+	stats := StageStats{Samples: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	n := len(sorted)
+	stats.Mean = sum / float64(n)
+	stats.Min = sorted[0]
+	stats.Max = sorted[n-1]
+
+	if n%2 == 1 {
+		stats.Median = sorted[n/2]
+	} else {
+		stats.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+
+	rank := int(math.Ceil(0.95*float64(n))) - 1
+	stats.P95 = sorted[rank]
+
+	if n > 1 {
+		variance := 0.0
+		for _, v := range sorted {
+			variance += (v - stats.Mean) * (v - stats.Mean)
+		}
+		stats.StdDev = math.Sqrt(variance / float64(n-1))
+	}
+
+	return stats
+}
+
+// runBenchmarkIterations runs warmup iterations whose timings are discarded,
+// followed by measured iterations. The returned results and summary describe
+// the last measured iteration, with statistics over all measured iterations
+// attached to the summary.
+func runBenchmarkIterations(config BenchmarkConfig) ([]BenchmarkResult, BenchmarkSummary, error) {
+	iterations := max(config.Iterations, 1)
+
+	for i := 0; i < config.WarmupIterations; i++ {
+		if _, _, err := benchmarkHTMLProcessing(config); err != nil {
+			return nil, BenchmarkSummary{}, err
+		}
+	}
+
+	var samples stageSamples
+	var results []BenchmarkResult
+	var summary BenchmarkSummary
+
+	for i := 0; i < iterations; i++ {
+		var err error
+		results, summary, err = benchmarkHTMLProcessing(config)
+		if err != nil {
+			return nil, summary, err
+		}
+		samples.add(results, summary)
+	}
+
+	summary.WarmupIterations = config.WarmupIterations
+	summary.Iterations = iterations
+	summary.Stages = samples.summarize()
+
+	return results, summary, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CaptureStreamEncoder writes compressed captures as JSON while they are
+// added, producing the same bytes as encoding the result of compressCaptures.
+// Captures must be added in timestamp order. Only the hash dictionary is kept
+// in memory, so memory is bounded by the number of distinct SimHashes rather
+// than the number of captures.
+type CaptureStreamEncoder struct {
+	w      *bufio.Writer
+	hashes *hashDictionary
+	// last is the previous capture's normalized timestamp.
+	last    string
+	started bool
+	closed  bool
+	err     error
+}
+
+// NewCaptureStreamEncoder returns an encoder writing to w. Close must be
+// called to write the hash dictionary and flush the output.
+func NewCaptureStreamEncoder(w io.Writer) *CaptureStreamEncoder {
+	return NewCaptureStreamEncoderWithOptions(w, CompressOptions{})
+}
+
+// NewCaptureStreamEncoderWithOptions is like NewCaptureStreamEncoder but
+// assigns hash IDs as described by opts.
+func NewCaptureStreamEncoderWithOptions(w io.Writer, opts CompressOptions) *CaptureStreamEncoder {
+	e := &CaptureStreamEncoder{
+		w:      bufio.NewWriter(w),
+		hashes: newHashDictionary(opts.HammingThreshold),
+	}
+	e.write(`{"captures":[`)
+	return e
+}
+
+// Add encodes one capture. Captures with malformed timestamps return a
+// *TimestampError and captures older than the previous one return an error;
+// in both cases nothing is written and the encoder can continue. Write
+// errors are returned by every later call.
+func (e *CaptureStreamEncoder) Add(capture TimeCapture) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return fmt.Errorf("capture stream encoder is closed")
+	}
+
+	ts, err := parseWaybackTimestamp(capture.Timestamp)
+	if err != nil {
+		return err
+	}
+	normalized := fmt.Sprintf("%04d%02d%02d%s", ts.Year, ts.Month, ts.Day, ts.Time)
+	if e.started && normalized < e.last {
+		return fmt.Errorf("capture %s added after %s: captures must be in timestamp order", capture.Timestamp, e.last)
+	}
+
+	switch {
+	case !e.started:
+		e.openYear(ts)
+	case normalized[:4] != e.last[:4]:
+		e.write("]]],")
+		e.openYear(ts)
+	case normalized[:6] != e.last[:6]:
+		e.write("]],")
+		e.openMonth(ts)
+	case normalized[:8] != e.last[:8]:
+		e.write("],")
+		e.openDay(ts)
+	default:
+		e.write(",")
+	}
+
+	id := e.hashes.id(capture.SimHash)
+	e.write(`["` + ts.Time + `",` + strconv.Itoa(id) + `]`)
+
+	e.started = true
+	e.last = normalized
+	return e.err
+}
+
+// Close closes the open groups, writes the hash dictionary and flushes the
+// output. It does not close the underlying writer.
+func (e *CaptureStreamEncoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if e.started {
+		e.write("]]]")
+	}
+	hashes, err := json.Marshal(e.hashes.hashes)
+	if err != nil {
+		return err
+	}
+	e.write(`],"hashes":` + string(hashes) + `}`)
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
+
+// openYear starts a year group and its first month.
+func (e *CaptureStreamEncoder) openYear(ts waybackTimestamp) {
+	e.write("[" + strconv.Itoa(ts.Year) + ",")
+	e.openMonth(ts)
+}
+
+// openMonth starts a month group and its first day.
+func (e *CaptureStreamEncoder) openMonth(ts waybackTimestamp) {
+	e.write("[" + strconv.Itoa(ts.Month) + ",")
+	e.openDay(ts)
+}
+
+// openDay starts a day group.
+func (e *CaptureStreamEncoder) openDay(ts waybackTimestamp) {
+	e.write("[" + strconv.Itoa(ts.Day) + ",")
+}
+
+// write writes s unless an earlier write failed.
+func (e *CaptureStreamEncoder) write(s string) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.WriteString(s)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Wayback Machine endpoints used unless configured otherwise
+const (
+	DefaultCDXEndpoint = "https://web.archive.org/web/timemap"
+	// DefaultReplayURLTemplate requests the original capture content (id_)
+	// without the Wayback Machine toolbar or URL rewriting
+	DefaultReplayURLTemplate = "https://web.archive.org/web/{timestamp}id_/{url}"
+)
+
+// validateArchiveConfig checks the CDX endpoint and replay URL template. The
+// template must contain the {timestamp} and {url} placeholders, e.g.
+// http://localhost:8080/my-web-archive/{timestamp}id_/{url} for pywb
+func validateArchiveConfig(cdxEndpoint, replayTemplate string) error {
+	if err := validateHTTPURL(cdxEndpoint); err != nil {
+		return fmt.Errorf("invalid CDX endpoint: %v", err)
+	}
+	for _, placeholder := range []string{"{timestamp}", "{url}"} {
+		if !strings.Contains(replayTemplate, placeholder) {
+			return fmt.Errorf("replay URL template %q is missing %s", replayTemplate, placeholder)
+		}
+	}
+	if err := validateHTTPURL(replayURL(replayTemplate, "20060102150405", "example.com")); err != nil {
+		return fmt.Errorf("invalid replay URL template: %v", err)
+	}
+	return nil
+}
+
+// validateHTTPURL checks that raw is an absolute http or https URL
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must be an http or https URL", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	return nil
+}
+
+// replayURL fills in a replay URL template. The capture URL is inserted
+// as-is, as archives expect it unescaped after the timestamp
+func replayURL(template, timestamp, captureURL string) string {
+	return strings.NewReplacer("{timestamp}", timestamp, "{url}", captureURL).Replace(template)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BatchJob is one URL and capture range to benchmark in batch mode
+type BatchJob struct {
+	URL   string
+	Range DateRange
+}
+
+// BatchRun summarises one job of a batch
+type BatchRun struct {
+	URL               string  `json:"url"`
+	From              string  `json:"from"`
+	To                string  `json:"to"`
+	File              string  `json:"file,omitempty"`
+	Error             string  `json:"error,omitempty"`
+	TotalCaptures     int     `json:"total_captures"`
+	SuccessfulFetches int     `json:"successful_fetches"`
+	FailedFetches     int     `json:"failed_fetches"`
+	CDXFetchTime      float64 `json:"cdx_fetch_time"`
+	DownloadTime      float64 `json:"download_time"`
+	TotalTime         float64 `json:"total_time"`
+}
+
+// BatchSummary combines the results of every job in a batch
+type BatchSummary struct {
+	Timestamp         string     `json:"timestamp"`
+	Jobs              int        `json:"jobs"`
+	FailedJobs        int        `json:"failed_jobs"`
+	TotalCaptures     int        `json:"total_captures"`
+	SuccessfulFetches int        `json:"successful_fetches"`
+	FailedFetches     int        `json:"failed_fetches"`
+	CDXFetchTime      float64    `json:"cdx_fetch_time"`
+	DownloadTime      float64    `json:"download_time"`
+	TotalTime         float64    `json:"total_time"`
+	Runs              []BatchRun `json:"runs"`
+}
+
+// readBatchJobs parses a batch list. Each line holds a URL optionally followed
+// by from and to timestamps; blank lines and lines starting with # are
+// skipped. Lines without a range use defaultRange, which may be nil
+func readBatchJobs(r io.Reader, defaultRange *DateRange) ([]BatchJob, error) {
+	var jobs []BatchJob
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected \"url [from [to]]\", got %d fields", lineNumber, len(fields))
+		}
+
+		job := BatchJob{URL: fields[0]}
+		switch {
+		case len(fields) > 1:
+			to := ""
+			if len(fields) == 3 {
+				to = fields[2]
+			}
+			dateRange, err := newDateRange(fields[1], to, "")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			job.Range = dateRange
+		case defaultRange != nil:
+			job.Range = *defaultRange
+		default:
+			return nil, fmt.Errorf("line %d: no range given and no -year or -from flag set", lineNumber)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// openBatchList opens the batch list at path, or stdin when path is -
+func openBatchList(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// runBatch benchmarks every job listed at path with the same client, so all
+// runs share one connection pool. Each run is saved as in single-URL mode and
+// a combined summary is written to the batch directory. A failed job is
+// recorded in the summary and does not stop the batch, but makes runBatch
+// return an error once the summary is saved
+func runBatch(client *Client, path string, query CDXQuery, defaultRange *DateRange) error {
+	list, err := openBatchList(path)
+	if err != nil {
+		return err
+	}
+	jobs, err := readBatchJobs(list, defaultRange)
+	list.Close()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("no jobs in batch list %s", path)
+	}
+
+	startTime := time.Now()
+	summary := BatchSummary{
+		Timestamp: startTime.Format(time.RFC3339),
+		Jobs:      len(jobs),
+		Runs:      make([]BatchRun, 0, len(jobs)),
+	}
+
+	for i, job := range jobs {
+		log.Printf("[%d/%d] Benchmarking %s, range %s", i+1, len(jobs), job.URL, job.Range.Label())
+
+		run := BatchRun{URL: job.URL, From: job.Range.From, To: job.Range.To}
+		benchmark, err := client.runBenchmark(job.URL, job.Range, query)
+		if err == nil {
+			run.File, err = saveBenchmark(client.config.BenchmarkDir, benchmark, job.Range)
+		}
+		if err != nil {
+			log.Printf("[%d/%d] Failed %s: %v", i+1, len(jobs), job.URL, err)
+			run.Error = err.Error()
+			summary.FailedJobs++
+		}
+
+		captures := benchmark.Summary.Captures
+		run.TotalCaptures = captures.Total
+		run.SuccessfulFetches = captures.SuccessfulFetches
+		run.FailedFetches = captures.FailedFetches
+		run.CDXFetchTime = benchmark.Summary.CDXFetchTime
+		run.DownloadTime = captures.DownloadTime
+		run.TotalTime = benchmark.Summary.TotalTime
+
+		summary.TotalCaptures += run.TotalCaptures
+		summary.SuccessfulFetches += run.SuccessfulFetches
+		summary.FailedFetches += run.FailedFetches
+		summary.CDXFetchTime += run.CDXFetchTime
+		summary.DownloadTime += run.DownloadTime
+		summary.Runs = append(summary.Runs, run)
+	}
+	summary.TotalTime = time.Since(startTime).Seconds()
+
+	// The summary lives in a subdirectory so that tools globbing the
+	// benchmark directory only see per-run files
+	batchDir := filepath.Join(client.config.BenchmarkDir, "batch")
+	if err := os.MkdirAll(batchDir, 0755); err != nil {
+		return err
+	}
+	summaryFile := filepath.Join(batchDir, fmt.Sprintf("summary_%s.json", startTime.Format("20060102150405")))
+	if err := writeJSONFile(summaryFile, summary); err != nil {
+		return err
+	}
+
+	log.Printf("Batch complete: %d jobs, %d failed", summary.Jobs, summary.FailedJobs)
+	log.Printf("Total time: %.2f seconds", summary.TotalTime)
+	log.Printf("Total captures: %d", summary.TotalCaptures)
+	log.Printf("Successful fetches: %d", summary.SuccessfulFetches)
+	log.Printf("Failed fetches: %d", summary.FailedFetches)
+	log.Printf("Summary saved to: %s", summaryFile)
+	if summary.FailedJobs > 0 {
+		return fmt.Errorf("%d of %d jobs failed", summary.FailedJobs, summary.Jobs)
+	}
+	return nil
+}
@@ -8,19 +8,23 @@ echo "Starting Go Benchmark..." > benchmarks-go/logs/go_benchmark.log
 
 start_time=$(date +%s)
 
+# All URL/year pairs run in one process so they share a build and a
+# connection pool; see benchmarks-go/batch/ for the combined summary
 for url in "${urls[@]}"; do
   for year in "${years[@]}"; do
-    echo "Benchmarking Go: $url ($year)"
-
-    go run main.go --url "$url" --year "$year" > /dev/null
+    echo "$url $year"
   done
-done
-
-wait
+done | go run . --batch - > /dev/null
+status=${PIPESTATUS[1]}
 
 end_time=$(date +%s)
 duration=$((end_time - start_time))
 
 echo "Total time: $duration sec" >> benchmarks-go/logs/go_benchmark.log
 
+if [ "$status" -ne 0 ]; then
+  echo "Go Benchmark failed (exit $status)" | tee -a benchmarks-go/logs/go_benchmark.log
+  exit "$status"
+fi
+
 echo "Go Benchmark Complete!"
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCDXCacheTTL is how long cached CDX responses are reused
+const DefaultCDXCacheTTL = 24 * time.Hour
+
+// cdxCache stores raw CDX responses on disk, one file per request keyed by
+// the endpoint and query parameters. A nil cache is disabled: every lookup
+// misses and nothing is stored
+type cdxCache struct {
+	dir string
+	ttl time.Duration
+	// refresh skips lookups but still stores fresh responses
+	refresh bool
+}
+
+// newCDXCache returns a cache in dir, or nil when dir is empty
+func newCDXCache(dir string, ttl time.Duration, refresh bool) *cdxCache {
+	if dir == "" {
+		return nil
+	}
+	return &cdxCache{dir: dir, ttl: ttl, refresh: refresh}
+}
+
+// defaultCDXCacheDir returns the per-user cache directory for CDX responses
+func defaultCDXCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "wayback-discover-diff-go", "cdx")
+	}
+	return filepath.Join(dir, "wayback-discover-diff-go", "cdx")
+}
+
+// path returns the cache file for a request. url.Values.Encode sorts the
+// parameters, so equivalent queries share a file
+func (c *cdxCache) path(endpoint string, params url.Values) string {
+	sum := sha256.Sum256([]byte(endpoint + "?" + params.Encode()))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".cdx")
+}
+
+// get returns the cached response for a request if it is younger than the TTL
+func (c *cdxCache) get(endpoint string, params url.Values) ([]byte, bool) {
+	if c == nil || c.refresh {
+		return nil, false
+	}
+	path := c.path(endpoint, params)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	age := time.Since(info.ModTime())
+	if c.ttl > 0 && age > c.ttl {
+		return nil, false
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	log.Printf("Using cached CDX response from %s ago", age.Round(time.Second))
+	return body, true
+}
+
+// put stores a response. The file is written under a temporary name and
+// renamed so concurrent runs never read a partial response
+func (c *cdxCache) put(endpoint string, params url.Values, body []byte) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(endpoint, params))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDX match types supported by the CDX server
+var cdxMatchTypes = map[string]bool{
+	"exact":  true,
+	"prefix": true,
+	"host":   true,
+	"domain": true,
+}
+
+// maxLoggedMalformedLines caps the malformed CDX lines printed by FetchCDX
+const maxLoggedMalformedLines = 5
+
+// cdxDefaultFields are the fields returned by the CDX server when fl is not set
+var cdxDefaultFields = []string{"urlkey", "timestamp", "original", "mimetype", "statuscode", "digest", "length"}
+
+// CDXQuery describes a CDX Server API query
+type CDXQuery struct {
+	URL string
+	// MatchType is one of exact, prefix, host or domain
+	MatchType string
+	From      string
+	To        string
+	// Filters are CDX filter expressions such as "statuscode:200" or
+	// "!mimetype:image/.*"
+	Filters []string
+	// Fields selects the returned fields (fl). Empty returns the server defaults
+	Fields   []string
+	Collapse []string
+	// OutputJSON requests output=json instead of space-separated lines
+	OutputJSON bool
+	FastLatest bool
+	// Sort is empty for the default order, "reverse" or "closest". Closest
+	// sorting requires Closest, the timestamp to sort around
+	Sort    string
+	Closest string
+	Limit   int
+	// ShowResumeKey asks the server to append a resume key when more
+	// results are available. ResumeKey continues a previous query
+	ShowResumeKey bool
+	ResumeKey     string
+	// PageSize sets the number of index blocks per page for page-based
+	// pagination
+	PageSize int
+}
+
+// Validate checks the query for values the CDX server would reject
+func (q CDXQuery) Validate() error {
+	if q.URL == "" {
+		return fmt.Errorf("CDX query requires a URL")
+	}
+	if q.MatchType != "" && !cdxMatchTypes[q.MatchType] {
+		return fmt.Errorf("invalid match type %q (expected exact, prefix, host or domain)", q.MatchType)
+	}
+	if q.Sort != "" && q.Sort != "reverse" && q.Sort != "closest" {
+		return fmt.Errorf("invalid sort %q (expected reverse or closest)", q.Sort)
+	}
+	if q.Sort == "closest" && q.Closest == "" {
+		return fmt.Errorf("closest sort requires a closest timestamp")
+	}
+	// Other match types return captures of other URLs, which can only be
+	// downloaded with their original URL
+	if q.MatchType != "" && q.MatchType != "exact" && len(q.Fields) > 0 && !containsString(q.Fields, "original") {
+		return fmt.Errorf("match type %s requires the original field in fl", q.MatchType)
+	}
+	return nil
+}
+
+// Values encodes the query as CDX server parameters
+func (q CDXQuery) Values() url.Values {
+	v := url.Values{}
+	v.Set("url", q.URL)
+	if q.MatchType != "" {
+		v.Set("matchType", q.MatchType)
+	}
+	if q.From != "" {
+		v.Set("from", q.From)
+	}
+	if q.To != "" {
+		v.Set("to", q.To)
+	}
+	for _, filter := range q.Filters {
+		v.Add("filter", filter)
+	}
+	if len(q.Fields) > 0 {
+		v.Set("fl", strings.Join(q.Fields, ","))
+	}
+	for _, collapse := range q.Collapse {
+		v.Add("collapse", collapse)
+	}
+	if q.OutputJSON {
+		v.Set("output", "json")
+	}
+	if q.FastLatest {
+		v.Set("fastLatest", "true")
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Closest != "" {
+		v.Set("closest", q.Closest)
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.ShowResumeKey {
+		v.Set("showResumeKey", "true")
+	}
+	if q.ResumeKey != "" {
+		v.Set("resumeKey", q.ResumeKey)
+	}
+	if q.PageSize > 0 {
+		v.Set("pageSize", strconv.Itoa(q.PageSize))
+	}
+	return v
+}
+
+// fields returns the field names the server returns for this query
+func (q CDXQuery) fields() []string {
+	if len(q.Fields) > 0 {
+		return q.Fields
+	}
+	return cdxDefaultFields
+}
+
+// splitResumeKey separates the resume key that follows a blank line at the
+// end of a text CDX response. A page without captures is just the blank
+// line and the key
+func splitResumeKey(body string) (string, string) {
+	body = strings.TrimRight(body, "\n")
+	if strings.HasPrefix(body, "\n") && !strings.Contains(body[1:], "\n") {
+		return "", strings.TrimSpace(body[1:])
+	}
+	i := strings.LastIndex(body, "\n\n")
+	if i < 0 {
+		return body, ""
+	}
+	key := strings.TrimSpace(body[i+2:])
+	if strings.Contains(key, "\n") {
+		return body, ""
+	}
+	return body[:i], key
+}
+
+// parseCDXResponse parses a CDX response body in the format requested by
+// query. Bodies that are not JSON are parsed as text even when JSON was
+// requested, so that error pages show up as malformed lines
+func parseCDXResponse(body []byte, query CDXQuery) (CDXPage, error) {
+	if query.OutputJSON && looksLikeJSON(body) {
+		return parseCDXJSON(body)
+	}
+
+	var page CDXPage
+	text := string(body)
+	if query.ShowResumeKey {
+		text, page.ResumeKey = splitResumeKey(text)
+	}
+	page.Captures, page.Malformed = parseCDXText(text, query.fields(), len(query.Fields) > 0)
+	return page, nil
+}
+
+// requestCDX returns the CDX response for the given parameters, from the
+// cache when a fresh copy is available. Fetched responses are only cached
+// when cacheable accepts them, so error pages served with status 200 are not
+// reused on later runs
+func (c *Client) requestCDX(params url.Values, cacheable func([]byte) bool) ([]byte, error) {
+	if body, ok := c.cdxCache.get(c.config.CDXEndpoint, params); ok {
+		c.cdxCacheHits.Add(1)
+		return body, nil
+	}
+
+	body, err := c.fetchCDXResponse(params)
+	if err != nil {
+		return nil, err
+	}
+	if c.cdxCache != nil && cacheable(body) {
+		if err := c.cdxCache.put(c.config.CDXEndpoint, params, body); err != nil {
+			log.Printf("Warning: failed to cache CDX response: %v", err)
+		}
+	}
+	return body, nil
+}
+
+// cacheableCDXPage accepts responses to query that parse to at least one
+// capture or to no malformed lines
+func cacheableCDXPage(query CDXQuery) func([]byte) bool {
+	return func(body []byte) bool {
+		page, err := parseCDXResponse(body, query)
+		return err == nil && (len(page.Captures) > 0 || len(page.Malformed) == 0)
+	}
+}
+
+// fetchCDXResponse performs one CDX request with the given parameters,
+// retrying failed requests, and returns the response body
+func (c *Client) fetchCDXResponse(params url.Values) ([]byte, error) {
+	var lastErr error
+	for attempt := 1; attempt <= max(c.config.MaxRetries, 1); attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+
+		req, err := http.NewRequest("GET", c.config.CDXEndpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating CDX request: %v", err)
+		}
+		req.URL.RawQuery = params.Encode()
+
+		// Set headers
+		req.Header.Set("User-Agent", c.userAgent)
+		req.Header.Set("Accept-Encoding", "gzip,deflate")
+		req.Header.Set("Connection", "keep-alive")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("CDX request failed: %v", err)
+			log.Printf("[Attempt %d] %v", attempt, lastErr)
+			continue
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("CDX request returned status %d", resp.StatusCode)
+			log.Printf("[Attempt %d] %v", attempt, lastErr)
+			continue
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("failed to read CDX response: %v", err)
+			log.Printf("[Attempt %d] %v", attempt, lastErr)
+			continue
+		}
+
+		return body, nil
+	}
+
+	return nil, lastErr
+}
+
+// FetchCDX retrieves the captures matching a CDX query, using the client's
+// configured pagination, along with any lines that could not be parsed.
+// A response made up only of malformed lines is an error
+func (c *Client) FetchCDX(query CDXQuery) ([]Capture, []MalformedCDXLine, error) {
+	log.Printf("Fetching CDX for %s from %s to %s", query.URL, query.From, query.To)
+	startTime := time.Now()
+
+	var captures []Capture
+	var malformed []MalformedCDXLine
+	err := c.FetchCDXPages(query, c.config.CDXPagination, func(page CDXPage) error {
+		captures = append(captures, page.Captures...)
+		malformed = append(malformed, page.Malformed...)
+		return nil
+	})
+	if err != nil {
+		return captures, malformed, err
+	}
+
+	if len(malformed) > 0 {
+		log.Printf("Warning: skipped %d malformed CDX lines", len(malformed))
+		for i, line := range malformed {
+			if i == maxLoggedMalformedLines {
+				log.Printf("  ... %d more", len(malformed)-i)
+				break
+			}
+			log.Printf("  %s", line)
+		}
+		if len(captures) == 0 {
+			return nil, malformed, fmt.Errorf("CDX response had %d lines and none could be parsed: %s", len(malformed), malformed[0])
+		}
+	}
+
+	log.Printf("CDX fetch completed in %.2f seconds, found %d captures",
+		time.Since(startTime).Seconds(), len(captures))
+
+	return captures, malformed, nil
+}
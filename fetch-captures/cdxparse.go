@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// cdxStandardFields is the 11-field CDX format "N b a m s k r M S V g"
+var cdxStandardFields = []string{"urlkey", "timestamp", "original", "mimetype", "statuscode", "digest", "redirect", "robotflags", "length", "offset", "filename"}
+
+// cdxLegacyFields is the 9-field CDX format "N b a m s k r V g"
+var cdxLegacyFields = []string{"urlkey", "timestamp", "original", "mimetype", "statuscode", "digest", "redirect", "offset", "filename"}
+
+// cdxHeaderLetters maps the letters of a " CDX ..." header line to field names
+var cdxHeaderLetters = map[string]string{
+	"N": "urlkey",
+	"b": "timestamp",
+	"a": "original",
+	"m": "mimetype",
+	"s": "statuscode",
+	"k": "digest",
+	"r": "redirect",
+	"M": "robotflags",
+	"S": "length",
+	"V": "offset",
+	"g": "filename",
+}
+
+// cdxjKeys maps the keys of a CDXJ JSON block to field names
+var cdxjKeys = map[string]string{
+	"url":        "original",
+	"mime":       "mimetype",
+	"status":     "statuscode",
+	"digest":     "digest",
+	"redirect":   "redirect",
+	"robotflags": "robotflags",
+	"length":     "length",
+	"offset":     "offset",
+	"filename":   "filename",
+}
+
+// maxMalformedText caps the line text kept in a MalformedCDXLine
+const maxMalformedText = 200
+
+// MalformedCDXLine describes a CDX line that could not be parsed
+type MalformedCDXLine struct {
+	// Line is the 1-based line number, or the row number for JSON output
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (m MalformedCDXLine) String() string {
+	return fmt.Sprintf("line %d: %s: %q", m.Line, m.Reason, m.Text)
+}
+
+// setCaptureField stores one CDX field value on the capture. Unknown fields
+// and "-" placeholders are ignored
+func setCaptureField(c *Capture, name, value string) error {
+	if value == "-" {
+		return nil
+	}
+	var err error
+	switch name {
+	case "urlkey":
+		c.URLKey = value
+	case "timestamp":
+		if len(value) != 14 {
+			return fmt.Errorf("timestamp %q must have 14 digits", value)
+		}
+		err = validateWaybackTimestamp(value)
+		c.Timestamp = value
+	case "original":
+		c.Original = value
+	case "mimetype":
+		c.MimeType = value
+	case "statuscode":
+		c.StatusCode, err = strconv.Atoi(value)
+	case "digest":
+		c.Digest = value
+	case "redirect":
+		c.Redirect = value
+	case "robotflags":
+		c.RobotFlags = value
+	case "length":
+		c.Length, err = strconv.ParseInt(value, 10, 64)
+	case "offset":
+		c.Offset, err = strconv.ParseInt(value, 10, 64)
+	case "filename":
+		c.Filename = value
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+	return nil
+}
+
+// cdxTextParser parses CDX text output line by line. Lines may be plain CDX
+// with columns given by the requested fields, standard 11-field or legacy
+// 9-field CDX, or CDXJ ("urlkey timestamp {json}"). A " CDX ..." header line
+// switches the column mapping for the lines that follow
+type cdxTextParser struct {
+	fields []string
+	// explicit is set when the fields were requested with fl, in which case
+	// lines must match them exactly
+	explicit  bool
+	captures  []Capture
+	malformed []MalformedCDXLine
+}
+
+// parseCDXText parses space-separated CDX or CDXJ lines and reports lines
+// that could not be parsed
+func parseCDXText(body string, fields []string, explicit bool) ([]Capture, []MalformedCDXLine) {
+	p := &cdxTextParser{fields: fields, explicit: explicit}
+	for i, line := range strings.Split(body, "\n") {
+		p.parseLine(i+1, strings.TrimRight(line, "\r"))
+	}
+	return p.captures, p.malformed
+}
+
+func (p *cdxTextParser) parseLine(number int, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	parts := strings.Fields(line)
+	if parts[0] == "CDX" {
+		p.parseHeader(number, line, parts[1:])
+		return
+	}
+
+	var capture Capture
+	var err error
+	switch {
+	case len(parts) >= 3 && strings.HasPrefix(parts[2], "{"):
+		capture, err = parseCDXJLine(line)
+	default:
+		capture, err = p.parseColumns(parts)
+	}
+	if err != nil {
+		p.reject(number, line, err.Error())
+		return
+	}
+	p.captures = append(p.captures, capture)
+}
+
+// parseHeader sets the column mapping from a " CDX N b a ..." header
+func (p *cdxTextParser) parseHeader(number int, line string, letters []string) {
+	fields := make([]string, len(letters))
+	for i, letter := range letters {
+		name, ok := cdxHeaderLetters[letter]
+		if !ok {
+			// Unknown columns are kept in place and ignored
+			name = "unknown:" + letter
+		}
+		fields[i] = name
+	}
+	if len(fields) == 0 {
+		p.reject(number, line, "empty CDX header")
+		return
+	}
+	p.fields = fields
+	p.explicit = true
+}
+
+// parseColumns maps space-separated columns to fields. Without explicit
+// fields, the standard and legacy layouts are recognised by column count
+func (p *cdxTextParser) parseColumns(parts []string) (Capture, error) {
+	fields := p.fields
+	if len(parts) != len(fields) && !p.explicit {
+		switch len(parts) {
+		case len(cdxStandardFields):
+			fields = cdxStandardFields
+		case len(cdxLegacyFields):
+			fields = cdxLegacyFields
+		}
+	}
+	if len(parts) != len(fields) {
+		return Capture{}, fmt.Errorf("expected %d fields, got %d", len(fields), len(parts))
+	}
+
+	var capture Capture
+	for i, name := range fields {
+		if err := setCaptureField(&capture, name, parts[i]); err != nil {
+			return capture, err
+		}
+	}
+	return capture, nil
+}
+
+// parseCDXJLine parses a CDXJ line: urlkey, timestamp and a JSON object,
+// separated by any whitespace
+func parseCDXJLine(line string) (Capture, error) {
+	var capture Capture
+	rest := strings.TrimSpace(line)
+	for _, name := range []string{"urlkey", "timestamp"} {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return capture, fmt.Errorf("expected urlkey, timestamp and JSON block")
+		}
+		if err := setCaptureField(&capture, name, rest[:end]); err != nil {
+			return capture, err
+		}
+		rest = strings.TrimLeftFunc(rest[end:], unicode.IsSpace)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(rest))
+	decoder.UseNumber()
+	var block map[string]interface{}
+	if err := decoder.Decode(&block); err != nil {
+		return capture, fmt.Errorf("invalid CDXJ block: %v", err)
+	}
+	for key, value := range block {
+		name, ok := cdxjKeys[key]
+		if !ok {
+			continue
+		}
+		if err := setCaptureField(&capture, name, fmt.Sprint(value)); err != nil {
+			return capture, err
+		}
+	}
+	return capture, nil
+}
+
+func (p *cdxTextParser) reject(number int, line, reason string) {
+	if len(line) > maxMalformedText {
+		line = line[:maxMalformedText] + "..."
+	}
+	p.malformed = append(p.malformed, MalformedCDXLine{Line: number, Text: line, Reason: reason})
+}
+
+// parseCDXJSON parses output=json responses: an array of rows whose first
+// row names the fields. With showResumeKey the rows end with an empty row
+// followed by a row holding the resume key
+func parseCDXJSON(body []byte) (CDXPage, error) {
+	var page CDXPage
+	var rows [][]string
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return page, fmt.Errorf("invalid CDX JSON: %v", err)
+	}
+
+	if n := len(rows); n >= 2 && len(rows[n-2]) == 0 && len(rows[n-1]) == 1 {
+		page.ResumeKey = rows[n-1][0]
+		rows = rows[:n-2]
+	}
+	if len(rows) == 0 {
+		return page, nil
+	}
+
+	header := rows[0]
+	page.Captures = make([]Capture, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		var capture Capture
+		err := fmt.Errorf("expected %d fields, got %d", len(header), len(row))
+		if len(row) == len(header) {
+			err = nil
+			for j, name := range header {
+				if err = setCaptureField(&capture, name, row[j]); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			text, _ := json.Marshal(row)
+			page.Malformed = append(page.Malformed, MalformedCDXLine{Line: i + 2, Text: string(text), Reason: err.Error()})
+			continue
+		}
+		page.Captures = append(page.Captures, capture)
+	}
+
+	return page, nil
+}
+
+// looksLikeJSON reports whether a response body is a JSON document, so that
+// error bodies and servers ignoring output=json are still parsed
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCDXResponse(t *testing.T) {
+	standard := Capture{
+		URLKey:     "com,example)/",
+		Timestamp:  "20230101000000",
+		Original:   "http://example.com/",
+		MimeType:   "text/html",
+		StatusCode: 200,
+		Digest:     "ABC",
+		Length:     1234,
+		Offset:     5678,
+		Filename:   "file.warc.gz",
+	}
+
+	tests := []struct {
+		name          string
+		body          string
+		query         CDXQuery
+		wantCaptures  []Capture
+		wantMalformed []int
+		wantResumeKey string
+	}{
+		{
+			name:  "requested fields",
+			body:  "20230101000000 ABC\n20230102000000 DEF\n",
+			query: CDXQuery{Fields: []string{"timestamp", "digest"}},
+			wantCaptures: []Capture{
+				{Timestamp: "20230101000000", Digest: "ABC"},
+				{Timestamp: "20230102000000", Digest: "DEF"},
+			},
+		},
+		{
+			name:         "standard 11-field",
+			body:         "com,example)/ 20230101000000 http://example.com/ text/html 200 ABC - - 1234 5678 file.warc.gz\n",
+			wantCaptures: []Capture{standard},
+		},
+		{
+			name: "legacy 9-field",
+			body: "com,example)/ 20230101000000 http://example.com/ text/html 200 ABC - 5678 file.warc.gz\n",
+			wantCaptures: []Capture{{
+				URLKey:     "com,example)/",
+				Timestamp:  "20230101000000",
+				Original:   "http://example.com/",
+				MimeType:   "text/html",
+				StatusCode: 200,
+				Digest:     "ABC",
+				Offset:     5678,
+				Filename:   "file.warc.gz",
+			}},
+		},
+		{
+			name: "CDX header",
+			body: " CDX N b a m s k r M S V g\ncom,example)/ 20230101000000 http://example.com/ text/html 200 ABC - - 1234 5678 file.warc.gz\n",
+			// The header overrides the requested fields
+			query:        CDXQuery{Fields: []string{"timestamp", "digest"}},
+			wantCaptures: []Capture{standard},
+		},
+		{
+			name:         "CDXJ",
+			body:         `com,example)/ 20230101000000 {"url": "http://example.com/", "mime": "text/html", "status": "200", "digest": "ABC", "length": 1234, "offset": "5678", "filename": "file.warc.gz"}` + "\n",
+			wantCaptures: []Capture{standard},
+		},
+		{
+			name: "CDXJ with tabs",
+			body: "com,example)/\t20230101000000\t{\"digest\": \"ABC\"}\n",
+			wantCaptures: []Capture{{
+				URLKey:    "com,example)/",
+				Timestamp: "20230101000000",
+				Digest:    "ABC",
+			}},
+		},
+		{
+			name:          "CDXJ without block",
+			body:          "com,example)/\t20230101000000\t{\n",
+			wantMalformed: []int{1},
+		},
+		{
+			name:          "error body",
+			body:          "<html>\n<body>Service Unavailable</body>\n</html>\n",
+			query:         CDXQuery{Fields: []string{"timestamp", "digest"}},
+			wantMalformed: []int{1, 2, 3},
+		},
+		{
+			name:          "invalid values",
+			body:          "20230101000000 ABC\n2023 DEF\n20230101000000 x 1\n",
+			query:         CDXQuery{Fields: []string{"timestamp", "digest"}},
+			wantCaptures:  []Capture{{Timestamp: "20230101000000", Digest: "ABC"}},
+			wantMalformed: []int{2, 3},
+		},
+		{
+			name:          "text resume key",
+			body:          "20230101000000 ABC\n\ncom%2Cexample%29%2F+20230101000000\n",
+			query:         CDXQuery{Fields: []string{"timestamp", "digest"}, ShowResumeKey: true},
+			wantCaptures:  []Capture{{Timestamp: "20230101000000", Digest: "ABC"}},
+			wantResumeKey: "com%2Cexample%29%2F+20230101000000",
+		},
+		{
+			name:          "text resume key without captures",
+			body:          "\ncom%2Cexample%29%2F+20230101000000\n",
+			query:         CDXQuery{Fields: []string{"timestamp", "digest"}, ShowResumeKey: true},
+			wantResumeKey: "com%2Cexample%29%2F+20230101000000",
+		},
+		{
+			name:  "JSON",
+			body:  `[["timestamp","statuscode"],["20230101000000","200"],["20230102000000"],["20230103000000","abc"]]`,
+			query: CDXQuery{OutputJSON: true},
+			wantCaptures: []Capture{
+				{Timestamp: "20230101000000", StatusCode: 200},
+			},
+			wantMalformed: []int{3, 4},
+		},
+		{
+			name:          "JSON resume key",
+			body:          `[["timestamp","digest"],["20230101000000","ABC"],[],["key"]]`,
+			query:         CDXQuery{OutputJSON: true, ShowResumeKey: true},
+			wantCaptures:  []Capture{{Timestamp: "20230101000000", Digest: "ABC"}},
+			wantResumeKey: "key",
+		},
+		{
+			name:          "JSON requested, error body returned",
+			body:          "<html>Service Unavailable</html>",
+			query:         CDXQuery{OutputJSON: true},
+			wantMalformed: []int{1},
+		},
+		{
+			name: "empty",
+			body: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := parseCDXResponse([]byte(tt.body), tt.query)
+			if err != nil {
+				t.Fatalf("parseCDXResponse: %v", err)
+			}
+			if len(page.Captures) != 0 || len(tt.wantCaptures) != 0 {
+				if !reflect.DeepEqual(page.Captures, tt.wantCaptures) {
+					t.Errorf("captures = %+v, want %+v", page.Captures, tt.wantCaptures)
+				}
+			}
+			var lines []int
+			for _, m := range page.Malformed {
+				lines = append(lines, m.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.wantMalformed) {
+				t.Errorf("malformed lines = %v, want %v (%v)", lines, tt.wantMalformed, page.Malformed)
+			}
+			if page.ResumeKey != tt.wantResumeKey {
+				t.Errorf("resume key = %q, want %q", page.ResumeKey, tt.wantResumeKey)
+			}
+		})
+	}
+}
+
+func TestParseCDXTextTruncatesMalformedLines(t *testing.T) {
+	long := make([]byte, 1000)
+	for i := range long {
+		long[i] = 'x'
+	}
+	_, malformed := parseCDXText(string(long), []string{"timestamp"}, true)
+	if len(malformed) != 1 {
+		t.Fatalf("got %d malformed lines, want 1", len(malformed))
+	}
+	if got := len(malformed[0].Text); got != maxMalformedText+len("...") {
+		t.Errorf("malformed text length = %d, want %d", got, maxMalformedText+len("..."))
+	}
+}
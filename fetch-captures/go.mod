@@ -0,0 +1,3 @@
+module github.com/rudransh-shrivastava/wayback-discover-diff-benchmarks-go-python/fetch-captures
+
+go 1.24.1
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,28 +12,82 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Concurrency      int
-	MaxRetries       int
-	Timeout          time.Duration
-	MaxCaptureSize   int64
-	BenchmarkDir     string
-	SnapshotsPerYear int
+	Concurrency    int
+	MaxRetries     int
+	Timeout        time.Duration
+	MaxCaptureSize int64
+	BenchmarkDir   string
+	// Snapshots is the sample size, per period for month, week and day
+	// sampling; -1 keeps every capture
+	Snapshots int
+	// Sampling is the capture sampling strategy, see sampleCaptures
+	Sampling string
+	// CDXPagination is one of none, resume or pages
+	CDXPagination string
+	// CDXPageLimit is the number of captures per request with resume keys
+	CDXPageLimit int
+	// CDXStartPage is the first page fetched with page-based pagination
+	CDXStartPage int
+	// CDXEndpoint is the CDX server queried for captures
+	CDXEndpoint string
+	// ReplayURLTemplate builds capture download URLs from the {timestamp}
+	// and {url} placeholders
+	ReplayURLTemplate string
+	// CaptureSource is one of cdx, timemap or timegate
+	CaptureSource string
+	// TimeMapURLTemplate and TimeGateURLTemplate build Memento URLs from the
+	// {url} placeholder
+	TimeMapURLTemplate  string
+	TimeGateURLTemplate string
+	// CDXCacheDir caches CDX responses on disk; empty disables the cache
+	CDXCacheDir string
+	// CDXCacheTTL is the maximum age of reused responses; 0 never expires
+	CDXCacheTTL time.Duration
+	// CDXCacheRefresh ignores cached responses but still stores new ones
+	CDXCacheRefresh bool
 }
 
-// Capture represents a wayback machine capture
+// Capture represents a wayback machine capture. Fields not requested from the
+// CDX server are left empty
 type Capture struct {
-	Timestamp string
-	Digest    string
+	URLKey     string
+	Timestamp  string
+	Original   string
+	MimeType   string
+	StatusCode int
+	Digest     string
+	Redirect   string
+	RobotFlags string
+	Length     int64
+	Offset     int64
+	Filename   string
+	// MementoURI is the capture's own URL when listed by a Memento TimeMap or
+	// TimeGate; it is downloaded directly instead of through the replay template
+	MementoURI string
+}
+
+// stringList is a flag.Value collecting repeated string flags
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 // CaptureResult stores the result of a capture download
 type CaptureResult struct {
 	Timestamp    string  `json:"timestamp"`
+	Original     string  `json:"original,omitempty"`
 	Digest       string  `json:"digest,omitempty"`
 	DownloadTime float64 `json:"download_time"`
 	Size         int     `json:"size,omitempty"`
@@ -44,7 +99,11 @@ type CaptureResult struct {
 // BenchmarkResult stores the complete benchmark data
 type BenchmarkResult struct {
 	URL             string          `json:"url"`
-	Year            string          `json:"year"`
+	Year            string          `json:"year,omitempty"`
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	Sampling        string          `json:"sampling,omitempty"`
+	Source          string          `json:"source,omitempty"`
 	Timestamp       string          `json:"timestamp"`
 	Summary         SummaryMetrics  `json:"summary"`
 	DetailedTimings []CaptureResult `json:"detailed_capture_timings"`
@@ -54,11 +113,19 @@ type BenchmarkResult struct {
 type SummaryMetrics struct {
 	Captures     CaptureMetrics `json:"captures"`
 	CDXFetchTime float64        `json:"cdx_fetch_time"`
-	TotalTime    float64        `json:"total_time"`
+	// CDXMalformedLines counts CDX lines skipped because they could not be parsed
+	CDXMalformedLines int `json:"cdx_malformed_lines,omitempty"`
+	// CDXCacheHits counts CDX requests answered from the local cache, in
+	// which case CDXFetchTime does not reflect the archive
+	CDXCacheHits int     `json:"cdx_cache_hits,omitempty"`
+	TotalTime    float64 `json:"total_time"`
 }
 
 // CaptureMetrics tracks overall capture processing metrics
 type CaptureMetrics struct {
+	// CDXTotal counts the captures returned by the CDX server, Total those
+	// left after sampling
+	CDXTotal          int     `json:"cdx_total"`
 	Total             int     `json:"total"`
 	Processed         int     `json:"processed"`
 	DownloadTime      float64 `json:"download_time"`
@@ -71,9 +138,25 @@ type Client struct {
 	httpClient *http.Client
 	config     Config
 	userAgent  string
+	cdxCache   *cdxCache
+	// cdxCacheHits counts CDX requests answered from the cache
+	cdxCacheHits atomic.Int64
 }
 
 func NewClient(config Config) *Client {
+	if config.CDXEndpoint == "" {
+		config.CDXEndpoint = DefaultCDXEndpoint
+	}
+	if config.ReplayURLTemplate == "" {
+		config.ReplayURLTemplate = DefaultReplayURLTemplate
+	}
+	if config.TimeMapURLTemplate == "" {
+		config.TimeMapURLTemplate = DefaultTimeMapURLTemplate
+	}
+	if config.TimeGateURLTemplate == "" {
+		config.TimeGateURLTemplate = DefaultTimeGateURLTemplate
+	}
+
 	transport := &http.Transport{
 		MaxIdleConns:        config.Concurrency,
 		MaxIdleConnsPerHost: config.Concurrency,
@@ -89,79 +172,17 @@ func NewClient(config Config) *Client {
 		httpClient: httpClient,
 		config:     config,
 		userAgent:  "wayback-discover-diff-go",
+		cdxCache:   newCDXCache(config.CDXCacheDir, config.CDXCacheTTL, config.CDXCacheRefresh),
 	}
 }
 
-// FetchCDX retrieves a list of captures for a URL in a specific year
-func (c *Client) FetchCDX(url, year string) ([]Capture, error) {
-	cdxURL := "https://web.archive.org/web/timemap"
-
-	req, err := http.NewRequest("GET", cdxURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating CDX request: %v", err)
-	}
-
-	// Set query parameters
-	q := req.URL.Query()
-	q.Set("url", url)
-	q.Set("from", year)
-	q.Set("to", year)
-	q.Set("statuscode", "200")
-	q.Set("fl", "timestamp,digest")
-	q.Set("collapse", "timestamp:9")
-
-	if c.config.SnapshotsPerYear > 0 {
-		q.Set("limit", fmt.Sprintf("%d", c.config.SnapshotsPerYear))
-	}
-
-	req.URL.RawQuery = q.Encode()
-
-	// Set headers
-	req.Header.Set("User-Agent", c.userAgent)
-	req.Header.Set("Accept-Encoding", "gzip,deflate")
-	req.Header.Set("Connection", "keep-alive")
-
-	log.Printf("Fetching CDX for %s for year %s", url, year)
-	startTime := time.Now()
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("CDX request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("CDX request returned status %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CDX response: %v", err)
-	}
-
-	// Parse the CDX response
-	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
-	captures := make([]Capture, 0, len(lines))
-
-	for _, line := range lines {
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) == 2 {
-			captures = append(captures, Capture{
-				Timestamp: parts[0],
-				Digest:    parts[1],
-			})
-		}
-	}
-
-	log.Printf("CDX fetch completed in %.2f seconds, found %d captures",
-		time.Since(startTime).Seconds(), len(captures))
-
-	return captures, nil
+// DownloadCapture downloads a specific capture from the configured archive with retries
+func (c *Client) DownloadCapture(timestamp, url string) (CaptureResult, []byte, error) {
+	return c.downloadCaptureURL(timestamp, replayURL(c.config.ReplayURLTemplate, timestamp, url))
 }
 
-// DownloadCapture downloads a specific capture from the Wayback Machine with retries
-func (c *Client) DownloadCapture(timestamp, url string) (CaptureResult, []byte, error) {
-	captureURL := fmt.Sprintf("https://web.archive.org/web/%sid_/%s", timestamp, url)
+// downloadCaptureURL downloads the capture at captureURL with retries
+func (c *Client) downloadCaptureURL(timestamp, captureURL string) (CaptureResult, []byte, error) {
 	result := CaptureResult{Timestamp: timestamp}
 
 	var data []byte
@@ -241,12 +262,26 @@ func (c *Client) processCapturesParallel(url string, captures []Capture) []Captu
 		go func() {
 			defer wg.Done()
 			for capture := range jobs {
-				result, _, err := c.DownloadCapture(capture.Timestamp, url)
+				// Prefix, host and domain queries return captures of other URLs
+				captureURL := url
+				if capture.Original != "" {
+					captureURL = capture.Original
+				}
+				var result CaptureResult
+				var err error
+				if capture.MementoURI != "" {
+					result, _, err = c.downloadCaptureURL(capture.Timestamp, capture.MementoURI)
+				} else {
+					result, _, err = c.DownloadCapture(capture.Timestamp, captureURL)
+				}
 				if err != nil {
 					result.Digest = capture.Digest
 				} else {
 					result.Digest = capture.Digest
 				}
+				if captureURL != url {
+					result.Original = captureURL
+				}
 				resultsChan <- result
 			}
 		}()
@@ -272,54 +307,258 @@ func (c *Client) processCapturesParallel(url string, captures []Capture) []Captu
 
 func main() {
 	url := flag.String("url", "", "URL to fetch from Wayback Machine")
-	year := flag.String("year", "", "Year to fetch captures for")
+	year := flag.String("year", "", "Year to fetch captures for (shorthand for -from and -to)")
+	from := flag.String("from", "", "Start of the capture range as a Wayback timestamp of any precision (e.g. 2023, 202306, 20230615120000)")
+	to := flag.String("to", "", "End of the capture range, inclusive (defaults to -from)")
 	concurrency := flag.Int("concurrency", 50, "Number of concurrent downloads")
 	timeout := flag.Int("timeout", 20, "Timeout in seconds for HTTP requests")
 	maxSize := flag.Int64("max-size", 1000000, "Maximum capture size to download")
-	snapshotsPerYear := flag.Int("snapshots", -1, "Number of snapshots per year (-1 for all)")
+	snapshots := flag.Int("snapshots", -1, "Number of snapshots to sample, per period for month, week and day sampling (-1 for all)")
+	sampling := flag.String("sample", SampleFirst, "Sampling strategy: first (CDX limit), even (spread across the range), month, week, day (N per period) or digest (distinct content only)")
+	var collapse stringList
+	flag.Var(&collapse, "collapse", "CDX collapse expression, e.g. timestamp:8 or digest (repeatable; default timestamp:9, none to disable)")
+	matchType := flag.String("match-type", "exact", "CDX match type: exact, prefix, host or domain (non-exact matches add original to -fl)")
+	var filters stringList
+	flag.Var(&filters, "filter", "CDX filter expression, e.g. statuscode:200 or !mimetype:image.* (repeatable; default statuscode:200)")
+	fields := flag.String("fl", "timestamp,digest", "Comma-separated CDX fields to return (e.g. urlkey,timestamp,original,mimetype,statuscode,digest,redirect,robotflags,length,offset,filename)")
+	outputJSON := flag.Bool("cdx-json", false, "Request CDX output=json")
+	fastLatest := flag.Bool("fast-latest", false, "Request CDX fastLatest")
+	sortOrder := flag.String("sort", "", "CDX sort order: reverse or closest")
+	closest := flag.String("closest", "", "Timestamp to sort around with -sort closest, or to negotiate with -source timegate")
+	source := flag.String("source", SourceCDX, "Capture source: cdx, timemap (Memento TimeMap) or timegate (closest Memento to -closest)")
+	timeMapTemplate := flag.String("timemap-url", DefaultTimeMapURLTemplate, "Memento TimeMap URL template with a {url} placeholder")
+	timeGateTemplate := flag.String("timegate-url", DefaultTimeGateURLTemplate, "Memento TimeGate URL template with a {url} placeholder")
+	pagination := flag.String("pagination", PaginationNone, "CDX pagination: none, resume (resume keys) or pages (page numbers)")
+	pageLimit := flag.Int("page-limit", 1000, "Captures per CDX request with -pagination resume")
+	pageSize := flag.Int("page-size", 0, "CDX pageSize (index blocks per page) with -pagination pages")
+	resumeKey := flag.String("resume-key", "", "Resume a CDX query from this resume key")
+	startPage := flag.Int("start-page", 0, "First page to fetch with -pagination pages")
+	cdxEndpoint := flag.String("cdx-url", DefaultCDXEndpoint, "CDX server endpoint, e.g. http://localhost:8080/my-web-archive/cdx for pywb")
+	replayTemplate := flag.String("replay-url", DefaultReplayURLTemplate, "Capture download URL template with {timestamp} and {url} placeholders")
+	// A cached response makes cdx_fetch_time measure a disk read rather than
+	// the archive; such runs record cdx_cache_hits
+	noCache := flag.Bool("no-cache", false, "Do not read or write the CDX response cache, so CDX fetch times measure the archive")
+	cacheDir := flag.String("cache-dir", defaultCDXCacheDir(), "Directory for cached CDX responses")
+	cacheTTL := flag.Duration("cache-ttl", DefaultCDXCacheTTL, "Maximum age of cached CDX responses (0 never expires)")
+	refresh := flag.Bool("refresh", false, "Ignore cached CDX responses and fetch fresh ones (they are still cached)")
+	batch := flag.String("batch", "", "File listing one \"url [from [to]]\" per line to benchmark in one process (- for stdin)")
+	profiling := registerProfileFlags()
 
 	flag.Parse()
 
-	if *url == "" || *year == "" {
-		log.Fatal("URL and year are required parameters")
+	if *noCache && *refresh {
+		log.Fatal("-refresh cannot be combined with -no-cache")
+	}
+
+	var dateRange DateRange
+	var defaultRange *DateRange
+	var err error
+	switch {
+	case *batch != "":
+		if *url != "" {
+			log.Fatal("-url cannot be combined with -batch")
+		}
+		// The range flags are optional in batch mode and only fill in lines
+		// without their own range
+		if *from != "" || *to != "" || *year != "" {
+			dateRange, err = newDateRange(*from, *to, *year)
+			if err != nil {
+				log.Fatalf("Invalid date range: %v", err)
+			}
+			defaultRange = &dateRange
+		}
+	case *url == "":
+		log.Fatal("URL or -batch is a required parameter")
+	default:
+		dateRange, err = newDateRange(*from, *to, *year)
+		if err != nil {
+			log.Fatalf("Invalid date range: %v", err)
+		}
 	}
 
 	config := Config{
-		Concurrency:      *concurrency,
-		MaxRetries:       2,
-		Timeout:          time.Duration(*timeout) * time.Second,
-		MaxCaptureSize:   *maxSize,
-		BenchmarkDir:     "benchmarks-go",
-		SnapshotsPerYear: *snapshotsPerYear,
+		Concurrency:         *concurrency,
+		MaxRetries:          2,
+		Timeout:             time.Duration(*timeout) * time.Second,
+		MaxCaptureSize:      *maxSize,
+		BenchmarkDir:        "benchmarks-go",
+		Snapshots:           *snapshots,
+		Sampling:            *sampling,
+		CDXPagination:       *pagination,
+		CDXPageLimit:        *pageLimit,
+		CDXStartPage:        *startPage,
+		CDXEndpoint:         *cdxEndpoint,
+		ReplayURLTemplate:   *replayTemplate,
+		CaptureSource:       *source,
+		TimeMapURLTemplate:  *timeMapTemplate,
+		TimeGateURLTemplate: *timeGateTemplate,
+		CDXCacheTTL:         *cacheTTL,
+		CDXCacheRefresh:     *refresh,
+	}
+	if !*noCache {
+		config.CDXCacheDir = *cacheDir
+	}
+	if err := validateArchiveConfig(config.CDXEndpoint, config.ReplayURLTemplate); err != nil {
+		log.Fatalf("Invalid archive configuration: %v", err)
+	}
+	switch config.CaptureSource {
+	case SourceCDX:
+	case SourceTimeMap, SourceTimeGate:
+		if err := validateMementoConfig(config.TimeMapURLTemplate, config.TimeGateURLTemplate); err != nil {
+			log.Fatalf("Invalid archive configuration: %v", err)
+		}
+	default:
+		log.Fatalf("Invalid capture source %q (expected cdx, timemap or timegate)", config.CaptureSource)
 	}
 
+	if len(filters) == 0 {
+		filters = stringList{"statuscode:200"}
+	}
+	switch {
+	case len(collapse) == 0:
+		collapse = stringList{"timestamp:9"}
+	case len(collapse) == 1 && collapse[0] == "none":
+		collapse = nil
+	}
+	query := CDXQuery{
+		MatchType:  *matchType,
+		Filters:    filters,
+		Collapse:   collapse,
+		OutputJSON: *outputJSON,
+		FastLatest: *fastLatest,
+		Sort:       *sortOrder,
+		Closest:    *closest,
+		ResumeKey:  *resumeKey,
+		PageSize:   *pageSize,
+	}
+	if *fields != "" {
+		query.Fields = strings.Split(*fields, ",")
+	}
+	// Captures of other URLs are downloaded by their original URL
+	if query.MatchType != "" && query.MatchType != "exact" && len(query.Fields) > 0 && !containsString(query.Fields, "original") {
+		query.Fields = append(query.Fields, "original")
+	}
+	if err := validateSampling(config.Sampling, query.Fields); err != nil {
+		log.Fatalf("Invalid sampling: %v", err)
+	}
+	// Other strategies need every capture in the range to choose from
+	if config.Sampling == SampleFirst && config.Snapshots > 0 {
+		query.Limit = config.Snapshots
+	}
+
+	client := NewClient(config)
+
 	// Ensure benchmark directory exists
 	os.MkdirAll(config.BenchmarkDir, 0755)
 
-	client := NewClient(config)
+	// Profiles are written alongside the benchmark results
+	stopProfiling, err := startProfiling(profiling, config.BenchmarkDir)
+	if err != nil {
+		log.Fatalf("Failed to start profiling: %v", err)
+	}
+
+	if *batch != "" {
+		err = runBatch(client, *batch, query, defaultRange)
+		if err != nil {
+			err = fmt.Errorf("batch failed: %v", err)
+		}
+	} else {
+		err = client.runSingle(*url, dateRange, query)
+	}
+
+	// Stop the profilers before exiting so failed runs still leave complete
+	// profiles behind
+	stopProfiling()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runSingle benchmarks url over dateRange and saves the results
+func (c *Client) runSingle(url string, dateRange DateRange, query CDXQuery) error {
+	benchmark, err := c.runBenchmark(url, dateRange, query)
+	if err != nil {
+		return fmt.Errorf("failed to fetch CDX: %v", err)
+	}
+
+	benchmarkFile, err := saveBenchmark(c.config.BenchmarkDir, benchmark, dateRange)
+	if err != nil {
+		return fmt.Errorf("failed to write benchmark results: %v", err)
+	}
+
+	log.Printf("Benchmark complete for %s, range %s", url, dateRange.Label())
+	log.Printf("Total time: %.2f seconds", benchmark.Summary.TotalTime)
+	log.Printf("CDX fetch time: %.2f seconds", benchmark.Summary.CDXFetchTime)
+	log.Printf("Total captures: %d", benchmark.Summary.Captures.Total)
+	log.Printf("Successful fetches: %d", benchmark.Summary.Captures.SuccessfulFetches)
+	log.Printf("Failed fetches: %d", benchmark.Summary.Captures.FailedFetches)
+	log.Printf("Total download time: %.2f seconds", benchmark.Summary.Captures.DownloadTime)
+	log.Printf("Results saved to: %s", benchmarkFile)
+	return nil
+}
 
+// runBenchmark fetches the CDX index of url over dateRange and downloads every
+// capture. query supplies the CDX options shared by all runs
+func (c *Client) runBenchmark(url string, dateRange DateRange, query CDXQuery) (BenchmarkResult, error) {
 	startTime := time.Now()
 
 	benchmark := BenchmarkResult{
-		URL:       *url,
-		Year:      *year,
+		URL:       url,
+		From:      dateRange.From,
+		To:        dateRange.To,
+		Sampling:  c.config.Sampling,
+		Source:    c.config.CaptureSource,
 		Timestamp: time.Now().Format(time.RFC3339),
 		Summary: SummaryMetrics{
 			Captures: CaptureMetrics{},
 		},
 	}
 
-	// Fetch CDX
+	benchmark.Year, _ = dateRange.Year()
+
+	query.URL = url
+	query.From = dateRange.From
+	query.To = dateRange.To
+
+	// Fetch CDX, or the Memento equivalent
 	cdxStartTime := time.Now()
-	captures, err := client.FetchCDX(*url, *year)
-	if err != nil {
-		log.Fatalf("Failed to fetch CDX: %v", err)
+	var captures []Capture
+	var err error
+	switch c.config.CaptureSource {
+	case SourceTimeMap:
+		captures, err = c.FetchTimeMap(url)
+		if err == nil {
+			captures, err = capturesInRange(captures, dateRange)
+		}
+	case SourceTimeGate:
+		captures, err = c.fetchTimeGateCapture(url, dateRange, query.Closest)
+	default:
+		var malformed []MalformedCDXLine
+		hits := c.cdxCacheHits.Load()
+		captures, malformed, err = c.FetchCDX(query)
+		benchmark.Summary.CDXMalformedLines = len(malformed)
+		benchmark.Summary.CDXCacheHits = int(c.cdxCacheHits.Load() - hits)
 	}
 	benchmark.Summary.CDXFetchTime = time.Since(cdxStartTime).Seconds()
+	if err != nil {
+		// Keep the count of captures listed before the failure and say how
+		// to continue from the failed page
+		benchmark.Summary.Captures.CDXTotal = len(captures)
+		var pageErr *CDXPageError
+		if errors.As(err, &pageErr) {
+			err = fmt.Errorf("%v; rerun with %s to continue", err, pageErr.ResumeFlag())
+		}
+		return benchmark, err
+	}
 
+	benchmark.Summary.Captures.CDXTotal = len(captures)
+	captures, err = sampleCaptures(captures, c.config.Sampling, c.config.Snapshots, dateRange)
+	if err != nil {
+		return benchmark, err
+	}
 	benchmark.Summary.Captures.Total = len(captures)
 
-	results := client.processCapturesParallel(*url, captures)
+	results := c.processCapturesParallel(url, captures)
 
 	// Update metrics
 	var totalDownloadTime float64
@@ -343,28 +582,28 @@ func main() {
 	benchmark.Summary.TotalTime = time.Since(startTime).Seconds()
 	benchmark.DetailedTimings = results
 
-	// Save benchmark results
-	safeURL := strings.ReplaceAll(strings.ReplaceAll(*url, ":", "_"), "/", "_")
-	benchmarkFile := filepath.Join(config.BenchmarkDir, fmt.Sprintf("%s_%s.json", safeURL, *year))
+	return benchmark, nil
+}
 
-	f, err := os.Create(benchmarkFile)
+// saveBenchmark writes benchmark to dir and returns the file path
+func saveBenchmark(dir string, benchmark BenchmarkResult, dateRange DateRange) (string, error) {
+	safeURL := strings.ReplaceAll(strings.ReplaceAll(benchmark.URL, ":", "_"), "/", "_")
+	benchmarkFile := filepath.Join(dir, fmt.Sprintf("%s_%s.json", safeURL, dateRange.Label()))
+	return benchmarkFile, writeJSONFile(benchmarkFile, benchmark)
+}
+
+// writeJSONFile writes v to path as indented JSON
+func writeJSONFile(path string, v interface{}) error {
+	f, err := os.Create(path)
 	if err != nil {
-		log.Fatalf("Failed to create benchmark file: %v", err)
+		return err
 	}
 
 	encoder := json.NewEncoder(f)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(benchmark); err != nil {
-		log.Fatalf("Failed to write benchmark results: %v", err)
+	if err := encoder.Encode(v); err != nil {
+		f.Close()
+		return err
 	}
-	f.Close()
-
-	log.Printf("Benchmark complete for %s, year %s", *url, *year)
-	log.Printf("Total time: %.2f seconds", benchmark.Summary.TotalTime)
-	log.Printf("CDX fetch time: %.2f seconds", benchmark.Summary.CDXFetchTime)
-	log.Printf("Total captures: %d", benchmark.Summary.Captures.Total)
-	log.Printf("Successful fetches: %d", benchmark.Summary.Captures.SuccessfulFetches)
-	log.Printf("Failed fetches: %d", benchmark.Summary.Captures.FailedFetches)
-	log.Printf("Total download time: %.2f seconds", benchmark.Summary.Captures.DownloadTime)
-	log.Printf("Results saved to: %s", benchmarkFile)
+	return f.Close()
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Capture sources
+const (
+	// SourceCDX lists captures with the CDX server API
+	SourceCDX = "cdx"
+	// SourceTimeMap lists captures with a Memento TimeMap (RFC 7089)
+	SourceTimeMap = "timemap"
+	// SourceTimeGate asks a Memento TimeGate for the single capture closest
+	// to a datetime
+	SourceTimeGate = "timegate"
+)
+
+// Memento endpoints of the Wayback Machine used unless configured otherwise
+const (
+	DefaultTimeMapURLTemplate  = "https://web.archive.org/web/timemap/link/{url}"
+	DefaultTimeGateURLTemplate = "https://web.archive.org/web/{url}"
+)
+
+// linkFormatType is the media type of Memento TimeMaps
+const linkFormatType = "application/link-format"
+
+// maxTimeMapPages caps the number of paged TimeMaps followed by FetchTimeMap
+const maxTimeMapPages = 1000
+
+// MementoLink is one link of an application/link-format document (RFC 6690)
+type MementoLink struct {
+	URI string
+	// Rel holds the space-separated relation types, e.g. "first memento"
+	Rel []string
+	// Params holds every link parameter by lower-case name, unquoted
+	Params map[string]string
+}
+
+// HasRel reports whether the link has the relation type rel
+func (l MementoLink) HasRel(rel string) bool {
+	for _, r := range l.Rel {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Datetime parses the datetime parameter of a memento link
+func (l MementoLink) Datetime() (time.Time, error) {
+	value, ok := l.Params["datetime"]
+	if !ok {
+		return time.Time{}, fmt.Errorf("memento %s has no datetime", l.URI)
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return t, fmt.Errorf("memento %s has invalid datetime %q", l.URI, value)
+	}
+	return t, nil
+}
+
+// parseLinkFormat parses an application/link-format document or Link header
+// value: comma-separated "<uri>; name=value; name="quoted value"" entries.
+// Commas inside <...> and quoted values, as in datetimes, do not split entries
+func parseLinkFormat(body string) ([]MementoLink, error) {
+	var links []MementoLink
+	s := body
+	for {
+		s = strings.TrimLeft(s, " \t\r\n,")
+		if s == "" {
+			return links, nil
+		}
+		if s[0] != '<' {
+			return links, fmt.Errorf("expected '<' at %q", truncate(s, 40))
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return links, fmt.Errorf("unterminated link target at %q", truncate(s, 40))
+		}
+		link := MementoLink{URI: s[1:end], Params: make(map[string]string)}
+		s = s[end+1:]
+
+		// Parameters until the next top-level comma
+		for {
+			s = strings.TrimLeft(s, " \t\r\n")
+			if s == "" || s[0] == ',' {
+				break
+			}
+			if s[0] != ';' {
+				return links, fmt.Errorf("expected ';' or ',' after link %s at %q", link.URI, truncate(s, 40))
+			}
+			s = strings.TrimLeft(s[1:], " \t\r\n")
+
+			nameEnd := strings.IndexAny(s, "=;,")
+			if nameEnd < 0 {
+				nameEnd = len(s)
+			}
+			name := strings.ToLower(strings.TrimSpace(s[:nameEnd]))
+			s = s[nameEnd:]
+
+			var value string
+			if strings.HasPrefix(s, "=") {
+				s = strings.TrimLeft(s[1:], " \t")
+				if strings.HasPrefix(s, `"`) {
+					quoteEnd := strings.IndexByte(s[1:], '"')
+					if quoteEnd < 0 {
+						return links, fmt.Errorf("unterminated quoted %s parameter of link %s", name, link.URI)
+					}
+					value = s[1 : quoteEnd+1]
+					s = s[quoteEnd+2:]
+				} else {
+					valueEnd := strings.IndexAny(s, ";,")
+					if valueEnd < 0 {
+						valueEnd = len(s)
+					}
+					value = strings.TrimSpace(s[:valueEnd])
+					s = s[valueEnd:]
+				}
+			}
+			link.Params[name] = value
+		}
+
+		link.Rel = strings.Fields(link.Params["rel"])
+		links = append(links, link)
+	}
+}
+
+// truncate shortens s to n bytes for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// timeMapCaptures converts the memento links of a TimeMap to captures. The
+// original resource link supplies the capture URL and each memento keeps its
+// own URI, so captures are downloaded from the archive that listed them
+func timeMapCaptures(links []MementoLink) ([]Capture, error) {
+	var original string
+	for _, link := range links {
+		if link.HasRel("original") {
+			original = link.URI
+			break
+		}
+	}
+
+	var captures []Capture
+	for _, link := range links {
+		if !link.HasRel("memento") {
+			continue
+		}
+		t, err := link.Datetime()
+		if err != nil {
+			return captures, err
+		}
+		captures = append(captures, Capture{
+			Timestamp:  t.UTC().Format(waybackTimestampLayout),
+			Original:   original,
+			MementoURI: link.URI,
+		})
+	}
+	return captures, nil
+}
+
+// resolveLinks makes relative link URIs absolute against the document URL
+func resolveLinks(links []MementoLink, base *url.URL) {
+	for i, link := range links {
+		ref, err := url.Parse(link.URI)
+		if err != nil {
+			continue
+		}
+		links[i].URI = base.ResolveReference(ref).String()
+	}
+}
+
+// nextTimeMap returns the URI of the next page of a paged TimeMap, if any
+func nextTimeMap(links []MementoLink) string {
+	for _, link := range links {
+		if link.HasRel("next") && (link.HasRel("timemap") || link.Params["type"] == linkFormatType) {
+			return link.URI
+		}
+	}
+	return ""
+}
+
+// getMemento performs a GET request with Memento headers, retrying failed
+// requests. The caller closes the response body
+func (c *Client) getMemento(target string, header http.Header) (*http.Response, error) {
+	var lastErr error
+	for attempt := 1; attempt <= max(c.config.MaxRetries, 1); attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating Memento request: %v", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("memento request failed: %v", err)
+			log.Printf("[Attempt %d] %v", attempt, lastErr)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("memento request to %s returned status %d", target, resp.StatusCode)
+			log.Printf("[Attempt %d] %v", attempt, lastErr)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// FetchTimeMap retrieves every capture of url listed in its Memento TimeMap,
+// following paged TimeMaps
+func (c *Client) FetchTimeMap(url string) ([]Capture, error) {
+	log.Printf("Fetching TimeMap for %s", url)
+	startTime := time.Now()
+
+	var captures []Capture
+	target := replayURL(c.config.TimeMapURLTemplate, "", url)
+	for page := 0; target != "" && page < maxTimeMapPages; page++ {
+		resp, err := c.getMemento(target, http.Header{"Accept": {linkFormatType}})
+		if err != nil {
+			return captures, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return captures, fmt.Errorf("failed to read TimeMap: %v", err)
+		}
+
+		links, err := parseLinkFormat(string(body))
+		if err != nil {
+			return captures, fmt.Errorf("invalid TimeMap %s: %v", target, err)
+		}
+		resolveLinks(links, resp.Request.URL)
+		pageCaptures, err := timeMapCaptures(links)
+		if err != nil {
+			return captures, fmt.Errorf("invalid TimeMap %s: %v", target, err)
+		}
+		captures = append(captures, pageCaptures...)
+		target = nextTimeMap(links)
+	}
+
+	log.Printf("TimeMap fetch completed in %.2f seconds, found %d captures",
+		time.Since(startTime).Seconds(), len(captures))
+	return captures, nil
+}
+
+// FetchClosestMemento asks the TimeGate of url for the capture closest to
+// at using Accept-Datetime negotiation. Redirects to the memento are
+// followed; the memento's Memento-Datetime header gives the capture time
+func (c *Client) FetchClosestMemento(url string, at time.Time) (Capture, error) {
+	target := replayURL(c.config.TimeGateURLTemplate, "", url)
+	header := http.Header{"Accept-Datetime": {at.UTC().Format(http.TimeFormat)}}
+	resp, err := c.getMemento(target, header)
+	if err != nil {
+		return Capture{}, err
+	}
+	resp.Body.Close()
+
+	value := resp.Header.Get("Memento-Datetime")
+	if value == "" {
+		return Capture{}, fmt.Errorf("TimeGate %s did not return a memento", target)
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return Capture{}, fmt.Errorf("invalid Memento-Datetime %q", value)
+	}
+
+	capture := Capture{
+		Timestamp:  t.UTC().Format(waybackTimestampLayout),
+		Original:   url,
+		MementoURI: resp.Request.URL.String(),
+	}
+	if links, err := parseLinkFormat(resp.Header.Get("Link")); err == nil {
+		for _, link := range links {
+			if link.HasRel("original") {
+				capture.Original = link.URI
+				break
+			}
+		}
+	}
+	return capture, nil
+}
+
+// fetchTimeGateCapture negotiates the capture of url closest to the closest
+// timestamp, or to the start of dateRange when closest is empty
+func (c *Client) fetchTimeGateCapture(url string, dateRange DateRange, closest string) ([]Capture, error) {
+	if closest == "" {
+		closest = dateRange.From
+	}
+	if err := validateWaybackTimestamp(closest); err != nil {
+		return nil, err
+	}
+	at, err := parseTimestampPrefix(closest)
+	if err != nil {
+		return nil, err
+	}
+	capture, err := c.FetchClosestMemento(url, at)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("TimeGate returned capture %s for %s", capture.Timestamp, closest)
+	return []Capture{capture}, nil
+}
+
+// capturesInRange keeps the captures whose timestamps fall within dateRange
+func capturesInRange(captures []Capture, dateRange DateRange) ([]Capture, error) {
+	start, end, err := dateRange.Bounds()
+	if err != nil {
+		return nil, err
+	}
+	inRange := captures[:0]
+	for _, c := range captures {
+		t, err := time.Parse(waybackTimestampLayout, c.Timestamp)
+		if err != nil || t.Before(start) || !t.Before(end) {
+			continue
+		}
+		inRange = append(inRange, c)
+	}
+	return inRange, nil
+}
+
+// validateMementoConfig checks the TimeMap and TimeGate URL templates, which
+// must contain the {url} placeholder
+func validateMementoConfig(timeMapTemplate, timeGateTemplate string) error {
+	for _, template := range []string{timeMapTemplate, timeGateTemplate} {
+		if !strings.Contains(template, "{url}") {
+			return fmt.Errorf("memento URL template %q is missing {url}", template)
+		}
+		if err := validateHTTPURL(replayURL(template, "", "example.com")); err != nil {
+			return fmt.Errorf("invalid memento URL template: %v", err)
+		}
+	}
+	return nil
+}
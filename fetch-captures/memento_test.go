@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkFormat(t *testing.T) {
+	body := `<http://example.com/>; rel="original",
+<http://archive.test/timemap/link/http://example.com/>; rel="self"; type="application/link-format"; from="Sat, 31 Dec 2022 00:00:00 GMT",
+<http://archive.test/20221231000000/http://example.com/?a=1,2>; rel="first memento"; datetime="Sat, 31 Dec 2022 00:00:00 GMT",
+<http://archive.test/20230301120000/http://example.com/>;rel=memento;datetime="Wed, 01 Mar 2023 12:00:00 GMT"`
+
+	links, err := parseLinkFormat(body)
+	if err != nil {
+		t.Fatalf("parseLinkFormat: %v", err)
+	}
+	if len(links) != 4 {
+		t.Fatalf("got %d links, want 4: %+v", len(links), links)
+	}
+
+	// Commas inside <...> and quoted datetimes do not split links
+	first := links[2]
+	if first.URI != "http://archive.test/20221231000000/http://example.com/?a=1,2" {
+		t.Errorf("URI = %q", first.URI)
+	}
+	if !reflect.DeepEqual(first.Rel, []string{"first", "memento"}) {
+		t.Errorf("rel = %q, want [first memento]", first.Rel)
+	}
+	if !first.HasRel("memento") || !first.HasRel("FIRST") || first.HasRel("last") {
+		t.Errorf("HasRel mismatch for %q", first.Rel)
+	}
+	if got := first.Params["datetime"]; got != "Sat, 31 Dec 2022 00:00:00 GMT" {
+		t.Errorf("datetime = %q", got)
+	}
+
+	// Unquoted parameter values without spaces
+	if !links[3].HasRel("memento") {
+		t.Errorf("rel = %q, want memento", links[3].Rel)
+	}
+	if links[1].Params["type"] != linkFormatType {
+		t.Errorf("type = %q, want %q", links[1].Params["type"], linkFormatType)
+	}
+
+	captures, err := timeMapCaptures(links)
+	if err != nil {
+		t.Fatalf("timeMapCaptures: %v", err)
+	}
+	want := []Capture{
+		{Timestamp: "20221231000000", Original: "http://example.com/", MementoURI: "http://archive.test/20221231000000/http://example.com/?a=1,2"},
+		{Timestamp: "20230301120000", Original: "http://example.com/", MementoURI: "http://archive.test/20230301120000/http://example.com/"},
+	}
+	if !reflect.DeepEqual(captures, want) {
+		t.Errorf("captures = %+v, want %+v", captures, want)
+	}
+}
+
+func TestParseLinkFormatErrors(t *testing.T) {
+	for _, body := range []string{
+		`http://example.com/; rel="original"`,
+		`<http://example.com/; rel="original"`,
+		`<http://example.com/>; rel="original`,
+		`<http://example.com/> rel="original"`,
+	} {
+		if _, err := parseLinkFormat(body); err == nil {
+			t.Errorf("parseLinkFormat(%q) succeeded, want error", body)
+		}
+	}
+}
+
+func TestFetchTimeMapPaged(t *testing.T) {
+	var downloaded []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/timemap/1/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<http://example.com/>; rel="original",
+</timemap/2/example.com>; rel="next timemap"; type="application/link-format",
+</mementos/1>; rel="first memento"; datetime="Sat, 31 Dec 2022 00:00:00 GMT"`)
+	})
+	mux.HandleFunc("/timemap/2/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<http://example.com/>; rel="original",
+</mementos/2>; rel="last memento"; datetime="Fri, 01 Sep 2023 00:00:00 GMT"`)
+	})
+	mux.HandleFunc("/mementos/", func(w http.ResponseWriter, r *http.Request) {
+		downloaded = append(downloaded, r.URL.Path)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html></html>")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(Config{
+		Concurrency:        1,
+		MaxRetries:         1,
+		MaxCaptureSize:     1000,
+		TimeMapURLTemplate: server.URL + "/timemap/1/{url}",
+		// Mementos must not be downloaded through the replay template
+		ReplayURLTemplate: "http://replay.invalid/{timestamp}/{url}",
+	})
+	captures, err := client.FetchTimeMap("example.com")
+	if err != nil {
+		t.Fatalf("FetchTimeMap: %v", err)
+	}
+	if len(captures) != 2 {
+		t.Fatalf("got %d captures, want 2: %+v", len(captures), captures)
+	}
+	if want := server.URL + "/mementos/2"; captures[1].MementoURI != want {
+		t.Errorf("relative memento URI resolved to %q, want %q", captures[1].MementoURI, want)
+	}
+
+	results := client.processCapturesParallel("example.com", captures)
+	for _, result := range results {
+		if result.Error != "" {
+			t.Errorf("download of %s failed: %s", result.Timestamp, result.Error)
+		}
+	}
+	if got := strings.Join(downloaded, ","); got != "/mementos/1,/mementos/2" {
+		t.Errorf("downloaded %q, want /mementos/1,/mementos/2", got)
+	}
+}
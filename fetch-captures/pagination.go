@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// CDX pagination modes
+const (
+	// PaginationNone fetches all captures with a single request
+	PaginationNone = "none"
+	// PaginationResumeKey fetches PageLimit captures per request and continues
+	// from the resume key returned by the server
+	PaginationResumeKey = "resume"
+	// PaginationPages asks the server for the number of pages and fetches
+	// them one by one
+	PaginationPages = "pages"
+)
+
+// CDXPage is one page of CDX results
+type CDXPage struct {
+	// Number counts pages from zero in the order they were fetched
+	Number   int
+	Captures []Capture
+	// ResumeKey continues the query after this page; empty on the last page
+	// or when not using resume keys
+	ResumeKey string
+	// Malformed lists the lines of the page that could not be parsed
+	Malformed []MalformedCDXLine
+}
+
+// CDXPageError reports a page that could not be fetched after all retries.
+// ResumeKey or Page can be used to continue the query from that point
+type CDXPageError struct {
+	Page      int
+	ResumeKey string
+	// Pages and Captures count what was fetched before the failure
+	Pages    int
+	Captures int
+	Err      error
+}
+
+func (e *CDXPageError) Error() string {
+	if e.ResumeKey != "" {
+		return fmt.Sprintf("CDX page %d (resume key %q) failed after %d pages with %d captures: %v",
+			e.Page, e.ResumeKey, e.Pages, e.Captures, e.Err)
+	}
+	return fmt.Sprintf("CDX page %d failed after %d pages with %d captures: %v", e.Page, e.Pages, e.Captures, e.Err)
+}
+
+// ResumeFlag returns the command line flag that continues the query from
+// the failed page
+func (e *CDXPageError) ResumeFlag() string {
+	if e.ResumeKey != "" {
+		return fmt.Sprintf("-resume-key %q", e.ResumeKey)
+	}
+	return fmt.Sprintf("-start-page %d", e.Page)
+}
+
+func (e *CDXPageError) Unwrap() error {
+	return e.Err
+}
+
+// FetchCDXPages retrieves the captures matching a CDX query page by page and
+// passes each page to fn as soon as it arrives. Failed requests are retried
+// from the same page or resume key; fn returning an error stops the fetch
+func (c *Client) FetchCDXPages(query CDXQuery, mode string, fn func(CDXPage) error) error {
+	if err := query.Validate(); err != nil {
+		return err
+	}
+
+	switch mode {
+	case "", PaginationNone:
+		body, err := c.requestCDX(query.Values(), cacheableCDXPage(query))
+		if err != nil {
+			return err
+		}
+		page, err := parseCDXResponse(body, query)
+		if err != nil {
+			return err
+		}
+		return fn(page)
+	case PaginationResumeKey:
+		return c.fetchCDXResumeKeyPages(query, fn)
+	case PaginationPages:
+		return c.fetchCDXNumberedPages(query, fn)
+	default:
+		return fmt.Errorf("invalid pagination mode %q (expected none, resume or pages)", mode)
+	}
+}
+
+// fetchCDXResumeKeyPages follows resume keys until the server stops returning
+// one. Query.Limit caps the total number of captures. A resume key seen
+// before would repeat pages forever, so it stops the fetch with an error
+func (c *Client) fetchCDXResumeKeyPages(query CDXQuery, fn func(CDXPage) error) error {
+	pageLimit := c.config.CDXPageLimit
+	if pageLimit <= 0 {
+		pageLimit = 1000
+	}
+	total := query.Limit
+
+	page := query
+	page.ShowResumeKey = true
+	fetched := 0
+	seen := map[string]bool{page.ResumeKey: true}
+
+	for number := 0; ; number++ {
+		page.Limit = pageLimit
+		if total > 0 {
+			page.Limit = min(pageLimit, total-fetched)
+		}
+
+		pageError := func(err error) error {
+			return &CDXPageError{Page: number, ResumeKey: page.ResumeKey, Pages: number, Captures: fetched, Err: err}
+		}
+		body, err := c.requestCDX(page.Values(), cacheableCDXPage(page))
+		if err != nil {
+			return pageError(err)
+		}
+		result, err := parseCDXResponse(body, page)
+		if err != nil {
+			return pageError(err)
+		}
+		result.Number = number
+		fetched += len(result.Captures)
+
+		if total > 0 && fetched >= total {
+			result.ResumeKey = ""
+		}
+		log.Printf("CDX page %d: %d captures", number, len(result.Captures))
+		if err := fn(result); err != nil {
+			return err
+		}
+
+		if result.ResumeKey == "" {
+			return nil
+		}
+		if seen[result.ResumeKey] {
+			return &CDXPageError{Page: number + 1, ResumeKey: result.ResumeKey, Pages: number + 1, Captures: fetched,
+				Err: fmt.Errorf("server returned resume key %q again", result.ResumeKey)}
+		}
+		seen[result.ResumeKey] = true
+		page.ResumeKey = result.ResumeKey
+	}
+}
+
+// fetchCDXNumberedPages asks the server how many pages the query spans and
+// fetches them in order, starting at the configured start page
+func (c *Client) fetchCDXNumberedPages(query CDXQuery, fn func(CDXPage) error) error {
+	params := query.Values()
+	params.Set("showNumPages", "true")
+	body, err := c.requestCDX(params, func(body []byte) bool {
+		_, err := parseNumPages(body)
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get CDX page count: %v", err)
+	}
+	numPages, err := parseNumPages(body)
+	if err != nil {
+		return err
+	}
+	log.Printf("CDX query spans %d pages", numPages)
+
+	fetched := 0
+	for number := c.config.CDXStartPage; number < numPages; number++ {
+		params := query.Values()
+		params.Set("page", strconv.Itoa(number))
+
+		pageError := func(err error) error {
+			return &CDXPageError{Page: number, Pages: number - c.config.CDXStartPage, Captures: fetched, Err: err}
+		}
+		body, err := c.requestCDX(params, cacheableCDXPage(query))
+		if err != nil {
+			return pageError(err)
+		}
+		page, err := parseCDXResponse(body, query)
+		if err != nil {
+			return pageError(err)
+		}
+		page.Number = number
+		fetched += len(page.Captures)
+
+		log.Printf("CDX page %d/%d: %d captures", number+1, numPages, len(page.Captures))
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseNumPages parses a showNumPages response, which is a bare number or,
+// with output=json, an object with a pages field
+func parseNumPages(body []byte) (int, error) {
+	text := strings.TrimSpace(string(body))
+	if n, err := strconv.Atoi(text); err == nil {
+		return n, nil
+	}
+
+	var v struct {
+		Pages int `json:"pages"`
+	}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return 0, fmt.Errorf("invalid CDX page count %q", text)
+	}
+	return v.Pages, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchCDXResumeKeyRepeated(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 10 {
+			t.Error("resume key loop did not stop")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		// The first page is followed by a page with no captures whose key
+		// never changes
+		if r.URL.Query().Get("resumeKey") == "" {
+			fmt.Fprint(w, "20230101000000 ABC\n\nkey1\n")
+			return
+		}
+		fmt.Fprint(w, "\nkey1\n")
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		Concurrency:   1,
+		MaxRetries:    1,
+		CDXEndpoint:   server.URL,
+		CDXPagination: PaginationResumeKey,
+	})
+	query := CDXQuery{URL: "example.com", Fields: []string{"timestamp", "digest"}}
+	captures, _, err := client.FetchCDX(query)
+
+	var pageErr *CDXPageError
+	if !errors.As(err, &pageErr) {
+		t.Fatalf("FetchCDX error = %v, want a CDXPageError", err)
+	}
+	if pageErr.Pages != 2 || pageErr.Captures != 1 || pageErr.ResumeKey != "key1" {
+		t.Errorf("error = %+v, want 2 pages, 1 capture and resume key key1", pageErr)
+	}
+	if len(captures) != 1 {
+		t.Errorf("got %d captures, want the 1 fetched before the error", len(captures))
+	}
+	if got := pageErr.ResumeFlag(); got != `-resume-key "key1"` {
+		t.Errorf("ResumeFlag() = %s", got)
+	}
+}
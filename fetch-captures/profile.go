@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof handlers on the default mux
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profileConfig holds the profiling outputs requested on the command line
+type profileConfig struct {
+	CPUProfile string
+	MemProfile string
+	Trace      string
+	PprofAddr  string
+}
+
+// registerProfileFlags registers the profiling flags on the default flag set
+func registerProfileFlags() *profileConfig {
+	cfg := &profileConfig{}
+	flag.StringVar(&cfg.CPUProfile, "cpuprofile", "", "Write a CPU profile to this file")
+	flag.StringVar(&cfg.MemProfile, "memprofile", "", "Write a heap profile to this file on exit")
+	flag.StringVar(&cfg.Trace, "trace", "", "Write an execution trace to this file")
+	flag.StringVar(&cfg.PprofAddr, "pprof-addr", "", "Serve live pprof data on this address (e.g. localhost:6060)")
+	return cfg
+}
+
+// startProfiling starts the requested profilers. Relative profile paths are
+// placed in outDir. The returned function stops the profilers and writes the
+// heap profile; it must be called before the program exits. On error any
+// profiler already started is stopped
+func startProfiling(cfg *profileConfig, outDir string) (func(), error) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	fail := func(err error) (func(), error) {
+		stop()
+		return nil, err
+	}
+
+	if cfg.PprofAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(cfg.PprofAddr, nil); err != nil {
+				log.Printf("pprof listener on %s stopped: %v", cfg.PprofAddr, err)
+			}
+		}()
+		log.Printf("Serving pprof on http://%s/debug/pprof/", cfg.PprofAddr)
+	}
+
+	if cfg.CPUProfile != "" {
+		f, err := createProfileFile(outDir, cfg.CPUProfile)
+		if err != nil {
+			return fail(err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fail(fmt.Errorf("failed to start CPU profile: %v", err))
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+
+	if cfg.Trace != "" {
+		f, err := createProfileFile(outDir, cfg.Trace)
+		if err != nil {
+			return fail(err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return fail(fmt.Errorf("failed to start trace: %v", err))
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+
+	if cfg.MemProfile != "" {
+		path := profilePath(outDir, cfg.MemProfile)
+		stops = append(stops, func() {
+			f, err := createProfileFile(outDir, cfg.MemProfile)
+			if err != nil {
+				log.Printf("%v", err)
+				return
+			}
+			defer f.Close()
+			runtime.GC() // get up-to-date statistics
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Printf("failed to write heap profile %s: %v", path, err)
+			}
+		})
+	}
+
+	return stop, nil
+}
+
+// profilePath resolves a profile file name against the output directory
+func profilePath(outDir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(outDir, name)
+}
+
+// createProfileFile creates the profile file, creating its directory if needed
+func createProfileFile(outDir, name string) (*os.File, error) {
+	path := profilePath(outDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory for %s: %v", path, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile file %s: %v", path, err)
+	}
+	return f, nil
+}
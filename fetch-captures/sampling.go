@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Capture sampling strategies
+const (
+	// SampleFirst keeps the first N captures returned by the CDX server by
+	// setting the CDX limit. Captures come back in time order, so the sample
+	// is taken from the start of the range
+	SampleFirst = "first"
+	// SampleEven keeps N captures spread evenly in time across the range
+	SampleEven = "even"
+	// SampleMonth, SampleWeek and SampleDay keep up to N captures per
+	// calendar month, ISO week or day, spread evenly within each period
+	SampleMonth = "month"
+	SampleWeek  = "week"
+	SampleDay   = "day"
+	// SampleDigest keeps the first capture of each distinct content digest,
+	// then N of those spread evenly across the range
+	SampleDigest = "digest"
+)
+
+var sampleStrategies = map[string]bool{
+	SampleFirst:  true,
+	SampleEven:   true,
+	SampleMonth:  true,
+	SampleWeek:   true,
+	SampleDay:    true,
+	SampleDigest: true,
+}
+
+// validateSampling checks a sampling strategy against the CDX fields it needs
+func validateSampling(strategy string, fields []string) error {
+	if !sampleStrategies[strategy] {
+		return fmt.Errorf("invalid sampling strategy %q (expected first, even, month, week, day or digest)", strategy)
+	}
+	if strategy == SampleDigest && len(fields) > 0 && !containsString(fields, "digest") {
+		return fmt.Errorf("digest sampling requires the digest field in -fl")
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// timedCapture is a capture with its parsed timestamp
+type timedCapture struct {
+	Capture
+	Time time.Time
+}
+
+// sampleCaptures selects captures from the range according to strategy. n is
+// the total sample size, or the size per period for month, week and day
+// sampling; n <= 0 keeps every capture, apart from digest deduplication.
+// Captures with unparseable timestamps are dropped. The result is in time order
+func sampleCaptures(captures []Capture, strategy string, n int, dateRange DateRange) ([]Capture, error) {
+	if strategy == SampleFirst {
+		// Already limited by the CDX server, but not by Memento sources
+		if n > 0 && len(captures) > n {
+			captures = captures[:n]
+		}
+		return captures, nil
+	}
+
+	start, end, err := dateRange.Bounds()
+	if err != nil {
+		return nil, err
+	}
+
+	timed := make([]timedCapture, 0, len(captures))
+	for _, c := range captures {
+		t, err := time.Parse(waybackTimestampLayout, c.Timestamp)
+		if err != nil {
+			continue
+		}
+		timed = append(timed, timedCapture{Capture: c, Time: t})
+	}
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].Time.Before(timed[j].Time)
+	})
+
+	var sampled []timedCapture
+	switch strategy {
+	case SampleEven:
+		sampled = sampleEvenly(timed, n, start, end)
+	case SampleDigest:
+		sampled = sampleEvenly(uniqueDigests(timed), n, start, end)
+	case SampleMonth, SampleWeek, SampleDay:
+		for len(timed) > 0 {
+			periodStart, periodEnd := samplingPeriod(timed[0].Time, strategy)
+			i := sort.Search(len(timed), func(i int) bool {
+				return !timed[i].Time.Before(periodEnd)
+			})
+			sampled = append(sampled, sampleEvenly(timed[:i], n, periodStart, periodEnd)...)
+			timed = timed[i:]
+		}
+	default:
+		return nil, fmt.Errorf("invalid sampling strategy %q", strategy)
+	}
+
+	result := make([]Capture, len(sampled))
+	for i, c := range sampled {
+		result[i] = c.Capture
+	}
+	return result, nil
+}
+
+// samplingPeriod returns the month, ISO week or day containing t
+func samplingPeriod(t time.Time, strategy string) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch strategy {
+	case SampleMonth:
+		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return month, month.AddDate(0, 1, 0)
+	case SampleWeek:
+		// ISO weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		week := day.AddDate(0, 0, -offset)
+		return week, week.AddDate(0, 0, 7)
+	default:
+		return day, day.AddDate(0, 0, 1)
+	}
+}
+
+// uniqueDigests keeps the first capture of each digest. Captures without a
+// digest are always kept
+func uniqueDigests(captures []timedCapture) []timedCapture {
+	seen := make(map[string]bool)
+	unique := make([]timedCapture, 0, len(captures))
+	for _, c := range captures {
+		if c.Digest != "" {
+			if seen[c.Digest] {
+				continue
+			}
+			seen[c.Digest] = true
+		}
+		unique = append(unique, c)
+	}
+	return unique
+}
+
+// sampleEvenly picks n captures from the time-ordered captures. The interval
+// [start, end) is split into n equal slots and the capture closest to the
+// middle of each slot is taken; when that capture is already taken the next
+// closest free one is used, so min(n, len(captures)) captures are returned
+func sampleEvenly(captures []timedCapture, n int, start, end time.Time) []timedCapture {
+	if n <= 0 || n >= len(captures) {
+		return captures
+	}
+
+	taken := make([]bool, len(captures))
+	slot := end.Sub(start) / time.Duration(n)
+	for i := 0; i < n; i++ {
+		target := start.Add(slot*time.Duration(i) + slot/2)
+		// First capture at or after the target
+		j := sort.Search(len(captures), func(j int) bool {
+			return !captures[j].Time.Before(target)
+		})
+		taken[nearestFree(captures, taken, j, target)] = true
+	}
+
+	sampled := make([]timedCapture, 0, n)
+	for i, c := range captures {
+		if taken[i] {
+			sampled = append(sampled, c)
+		}
+	}
+	return sampled
+}
+
+// nearestFree returns the index of the untaken capture closest to target,
+// searching outwards from index j. At least one capture must be free
+func nearestFree(captures []timedCapture, taken []bool, j int, target time.Time) int {
+	before, after := j-1, j
+	for before >= 0 && taken[before] {
+		before--
+	}
+	for after < len(captures) && taken[after] {
+		after++
+	}
+	switch {
+	case before < 0:
+		return after
+	case after >= len(captures):
+		return before
+	case target.Sub(captures[before].Time) <= captures[after].Time.Sub(target):
+		return before
+	default:
+		return after
+	}
+}
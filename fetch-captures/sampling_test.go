@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// timestamps returns the timestamps of captures in order
+func timestamps(captures []Capture) []string {
+	var ts []string
+	for _, c := range captures {
+		ts = append(ts, c.Timestamp)
+	}
+	return ts
+}
+
+// capturesAt builds captures with the given timestamps
+func capturesAt(ts ...string) []Capture {
+	captures := make([]Capture, len(ts))
+	for i, t := range ts {
+		captures[i] = Capture{Timestamp: t}
+	}
+	return captures
+}
+
+func TestSampleCaptures(t *testing.T) {
+	year2023 := DateRange{From: "2023", To: "2023"}
+
+	tests := []struct {
+		name     string
+		captures []Capture
+		strategy string
+		n        int
+		want     []string
+	}{
+		{
+			name:     "n at least the capture count keeps all in time order",
+			captures: capturesAt("20230601000000", "20230101000000", "bad", "20231231000000"),
+			strategy: SampleEven,
+			n:        3,
+			want:     []string{"20230101000000", "20230601000000", "20231231000000"},
+		},
+		{
+			name:     "n of zero keeps all",
+			captures: capturesAt("20230601000000", "20230101000000"),
+			strategy: SampleEven,
+			n:        0,
+			want:     []string{"20230101000000", "20230601000000"},
+		},
+		{
+			name:     "first truncates",
+			captures: capturesAt("20230101000000", "20230201000000", "20230301000000"),
+			strategy: SampleFirst,
+			n:        2,
+			want:     []string{"20230101000000", "20230201000000"},
+		},
+		{
+			// Slot targets fall on 2 March, 2 July and 1 November
+			name:     "evenly spread",
+			captures: capturesAt("20230101000000", "20230215000000", "20230401000000", "20230701000000", "20230901000000", "20231115000000", "20231231000000"),
+			strategy: SampleEven,
+			n:        3,
+			want:     []string{"20230215000000", "20230701000000", "20231115000000"},
+		},
+		{
+			// Every slot target is nearest to the same cluster, so later
+			// slots take the next closest free capture and n are returned
+			name: "clustered",
+			captures: capturesAt(
+				"20230101000000", "20230101010000", "20230101020000", "20230101030000", "20230101040000",
+				"20230101050000", "20230101060000", "20230101070000", "20230101080000", "20230101090000",
+				"20231220000000",
+			),
+			strategy: SampleEven,
+			n:        3,
+			want:     []string{"20230101080000", "20230101090000", "20231220000000"},
+		},
+		{
+			// Sunday 1 January 2023 belongs to the ISO week starting on
+			// Monday 26 December 2022
+			name:     "ISO week boundaries",
+			captures: capturesAt("20230101235959", "20230102000000", "20230108235959", "20230109000000"),
+			strategy: SampleWeek,
+			n:        1,
+			want:     []string{"20230101235959", "20230108235959", "20230109000000"},
+		},
+		{
+			name:     "month boundaries",
+			captures: capturesAt("20230131235959", "20230201000000", "20230215000000", "20230228235959", "20230301000000"),
+			strategy: SampleMonth,
+			n:        1,
+			want:     []string{"20230131235959", "20230215000000", "20230301000000"},
+		},
+		{
+			name:     "day boundaries",
+			captures: capturesAt("20230101235959", "20230102000000", "20230102120000", "20230102235959"),
+			strategy: SampleDay,
+			n:        1,
+			want:     []string{"20230101235959", "20230102120000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampled, err := sampleCaptures(tt.captures, tt.strategy, tt.n, year2023)
+			if err != nil {
+				t.Fatalf("sampleCaptures: %v", err)
+			}
+			if got := timestamps(sampled); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sampled %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleCapturesDigest(t *testing.T) {
+	captures := []Capture{
+		{Timestamp: "20230101000000", Digest: "A"},
+		{Timestamp: "20230201000000", Digest: "A"},
+		{Timestamp: "20230301000000", Digest: "B"},
+		{Timestamp: "20230401000000"},
+		{Timestamp: "20230501000000"},
+		{Timestamp: "20230601000000", Digest: "B"},
+		{Timestamp: "20230701000000", Digest: "C"},
+	}
+	year2023 := DateRange{From: "2023", To: "2023"}
+
+	// Only the first capture of each digest is kept; captures without a
+	// digest are never deduplicated
+	sampled, err := sampleCaptures(captures, SampleDigest, 0, year2023)
+	if err != nil {
+		t.Fatalf("sampleCaptures: %v", err)
+	}
+	want := []string{"20230101000000", "20230301000000", "20230401000000", "20230501000000", "20230701000000"}
+	if got := timestamps(sampled); !reflect.DeepEqual(got, want) {
+		t.Errorf("sampled %v, want %v", got, want)
+	}
+
+	sampled, err = sampleCaptures(captures, SampleDigest, 2, year2023)
+	if err != nil {
+		t.Fatalf("sampleCaptures: %v", err)
+	}
+	want = []string{"20230401000000", "20230701000000"}
+	if got := timestamps(sampled); !reflect.DeepEqual(got, want) {
+		t.Errorf("sampled %v, want %v", got, want)
+	}
+}
+
+func TestSamplingPeriod(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		at         time.Time
+		strategy   string
+		start, end time.Time
+	}{
+		{time.Date(2023, 1, 1, 23, 59, 59, 0, time.UTC), SampleWeek, date(2022, 12, 26), date(2023, 1, 2)},
+		{date(2023, 1, 2), SampleWeek, date(2023, 1, 2), date(2023, 1, 9)},
+		{date(2024, 2, 29), SampleMonth, date(2024, 2, 1), date(2024, 3, 1)},
+		{time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC), SampleDay, date(2023, 12, 31), date(2024, 1, 1)},
+	}
+	for _, tt := range tests {
+		start, end := samplingPeriod(tt.at, tt.strategy)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("samplingPeriod(%s, %s) = [%s, %s), want [%s, %s)", tt.at, tt.strategy, start, end, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateRange is an inclusive range of Wayback timestamps. Each bound may have
+// any precision from yyyy to yyyyMMddhhmmss
+type DateRange struct {
+	From string
+	To   string
+}
+
+// waybackTimestampLayout is the layout of a full 14-digit Wayback timestamp
+const waybackTimestampLayout = "20060102150405"
+
+// validateWaybackTimestamp checks that ts is a Wayback timestamp with a whole
+// number of components, from yyyy to yyyyMMddhhmmss
+func validateWaybackTimestamp(ts string) error {
+	if len(ts) < 4 || len(ts) > 14 || len(ts)%2 != 0 {
+		return fmt.Errorf("timestamp %q must have 4, 6, 8, 10, 12 or 14 digits", ts)
+	}
+	for _, c := range ts {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("timestamp %q contains non-digit %q", ts, c)
+		}
+	}
+	return nil
+}
+
+// newDateRange builds a range from the -from, -to and -year flags. A year sets
+// both bounds, and a missing -to defaults to -from
+func newDateRange(from, to, year string) (DateRange, error) {
+	if year != "" {
+		if from != "" || to != "" {
+			return DateRange{}, fmt.Errorf("-year cannot be combined with -from or -to")
+		}
+		from, to = year, year
+	}
+	if from == "" {
+		return DateRange{}, fmt.Errorf("a year or -from timestamp is required")
+	}
+	if to == "" {
+		to = from
+	}
+
+	r := DateRange{From: from, To: to}
+	if err := validateWaybackTimestamp(r.From); err != nil {
+		return r, err
+	}
+	if err := validateWaybackTimestamp(r.To); err != nil {
+		return r, err
+	}
+	start, end, err := r.Bounds()
+	if err != nil {
+		return r, err
+	}
+	if !start.Before(end) {
+		return r, fmt.Errorf("range start %s is after range end %s", r.From, r.To)
+	}
+	return r, nil
+}
+
+// Year returns the year when the range covers exactly one calendar year
+func (r DateRange) Year() (string, bool) {
+	if len(r.From) == 4 && r.From == r.To {
+		return r.From, true
+	}
+	return "", false
+}
+
+// Label names the range in output files and logs: the bound itself when
+// both are equal, otherwise from-to
+func (r DateRange) Label() string {
+	if r.From == r.To {
+		return r.From
+	}
+	return r.From + "-" + r.To
+}
+
+// timestampPrecision is the time covered by the last component of a Wayback
+// timestamp of each length
+var timestampPrecision = map[int]func(time.Time) time.Time{
+	4:  func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+	6:  func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	8:  func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	10: func(t time.Time) time.Time { return t.Add(time.Hour) },
+	12: func(t time.Time) time.Time { return t.Add(time.Minute) },
+	14: func(t time.Time) time.Time { return t.Add(time.Second) },
+}
+
+// parseTimestampPrefix parses a Wayback timestamp of any precision as the
+// first instant it covers
+func parseTimestampPrefix(ts string) (time.Time, error) {
+	padded := ts + "0101000000"[len(ts)-4:]
+	t, err := time.Parse(waybackTimestampLayout, padded)
+	if err != nil {
+		return t, fmt.Errorf("invalid timestamp %q: %v", ts, err)
+	}
+	return t, nil
+}
+
+// Bounds returns the range as a half-open interval [start, end) of UTC times
+func (r DateRange) Bounds() (time.Time, time.Time, error) {
+	start, err := parseTimestampPrefix(r.From)
+	if err != nil {
+		return start, start, err
+	}
+	to, err := parseTimestampPrefix(r.To)
+	if err != nil {
+		return start, start, err
+	}
+	return start, timestampPrecision[len(r.To)](to), nil
+}